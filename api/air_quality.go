@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// AirQualityProvider is a source of air quality, e.g. OpenWeatherMap or AirNow. Air quality
+// is stored as the US AQI, whatever the provider.
+type AirQualityProvider interface {
+	// Name identifies the provider in logs and in the stored air quality
+	Name() string
+	// AirQuality returns the current air quality and the forecast of the next days at a location
+	AirQuality(ctx context.Context, lat, lon string) (*AirQuality, error)
+}
+
+// AirQuality is the air quality of a park, as stored in its airQuality field
+type AirQuality struct {
+	Provider  string    `json:"provider"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// the current US AQI, and the pollutant driving it, e.g. PM2.5 for wildfire smoke
+	AQI       int    `json:"aqi"`
+	Pollutant string `json:"pollutant,omitempty"`
+	// the highest AQI of the next days, by local day
+	Forecast []AQIDay `json:"forecast,omitempty"`
+}
+
+// AQIDay is the highest AQI forecast for a day
+type AQIDay struct {
+	// yyyy-mm-dd
+	Day string `json:"day"`
+	AQI int    `json:"aqi"`
+}
+
+// stored air quality older than this isn't shown nor used to sort the parks
+const airQualityMaxAge = 12 * time.Hour
+
+// parks with an AQI from this one up, unhealthy for sensitive groups, are deprioritized
+const unhealthyAQI = 101
+
+// AQICategory returns the EPA category of an AQI
+func AQICategory(aqi int) string {
+	switch {
+	case aqi <= 50:
+		return "Good"
+	case aqi <= 100:
+		return "Moderate"
+	case aqi <= 150:
+		return "Unhealthy for sensitive groups"
+	case aqi <= 200:
+		return "Unhealthy"
+	case aqi <= 300:
+		return "Very unhealthy"
+	}
+	return "Hazardous"
+}
+
+// Unhealthy reports whether the air is unhealthy during a trip, judged on the forecast of
+// its days. Trips without dates are judged on the current air quality, trips beyond the
+// forecast are not judged.
+func (a *AirQuality) Unhealthy(trip TripDates) bool {
+	if a == nil {
+		return false
+	}
+	if !trip.IsSet() {
+		return a.AQI >= unhealthyAQI
+	}
+	for _, day := range a.Forecast {
+		if trip.Contains(day.Day) && day.AQI >= unhealthyAQI {
+			return true
+		}
+	}
+	return false
+}
+
+// DeprioritizeUnhealthyAir moves the parks with unhealthy air during the trip after the
+// others, keeping the order of both
+func DeprioritizeUnhealthyAir(parks []Park, trip TripDates) {
+	sort.SliceStable(parks, func(i, j int) bool {
+		return !parks[i].AirQuality.Unhealthy(trip) && parks[j].AirQuality.Unhealthy(trip)
+	})
+}
+
+// LoadAirQuality returns the air quality stored in a park record, nil if it has none or
+// it is too old to be shown
+func LoadAirQuality(record *models.Record) *AirQuality {
+	raw := record.GetString("airQuality")
+	if raw == "" || raw == "null" {
+		return nil
+	}
+	var airQuality AirQuality
+	if err := json.Unmarshal([]byte(raw), &airQuality); err != nil {
+		log.Printf("Invalid air quality of park %s: %v", record.GetString("parkCode"), err)
+		return nil
+	}
+	if time.Since(airQuality.UpdatedAt) > airQualityMaxAge {
+		return nil
+	}
+	return &airQuality
+}
+
+// FetchAndStoreAirQuality stores the current and forecast air quality of every park. Only
+// the airQuality column is written, so parks saved by other jobs meanwhile keep their data.
+func FetchAndStoreAirQuality(ctx context.Context, app *pocketbase.PocketBase, provider AirQualityProvider, run *JobRun) error {
+	parks, err := app.Dao().FindRecordsByExpr("parks", NotRetired)
+	if err != nil {
+		return err
+	}
+	for _, park := range parks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		airQuality, err := provider.AirQuality(ctx, park.GetString("latitude"), park.GetString("longitude"))
+		if err != nil {
+			log.Printf("Failed to fetch air quality for park %s: %s", park.GetString("parkCode"), err)
+			run.Fail("park "+park.GetString("parkCode"), err)
+			continue
+		}
+		encoded, err := json.Marshal(airQuality)
+		if err != nil {
+			log.Printf("Failed to encode air quality for park %s: %s", park.GetString("parkCode"), err)
+			run.Fail("park "+park.GetString("parkCode"), err)
+			continue
+		}
+		if _, err := app.Dao().DB().Update("parks", dbx.Params{"airQuality": string(encoded)}, dbx.HashExp{"id": park.Id}).Execute(); err != nil {
+			log.Printf("Failed to save air quality for park %s: %s", park.GetString("parkCode"), err)
+			run.Fail("park "+park.GetString("parkCode"), err)
+			continue
+		}
+		run.Updated()
+		log.Printf("Air quality saved for park %s", park.GetString("parkCode"))
+	}
+	return nil
+}
+
+// AirQualityConfig holds the settings of the air quality provider of a deployment
+type AirQualityConfig struct {
+	// Provider is "owm" or "airnow"
+	Provider     string
+	OWMAPIKey    string
+	AirNowAPIKey string
+}
+
+// NewAirQualityProvider returns the air quality provider configured for a deployment
+func NewAirQualityProvider(client *Client, config AirQualityConfig) (AirQualityProvider, error) {
+	switch strings.TrimSpace(config.Provider) {
+	case "owm":
+		if config.OWMAPIKey == "" {
+			return nil, errors.New("the owm air quality provider needs an API key")
+		}
+		return NewOWMAirQuality(client, config.OWMAPIKey), nil
+	case "airnow":
+		if config.AirNowAPIKey == "" {
+			return nil, errors.New("the airnow air quality provider needs an API key")
+		}
+		return NewAirNow(client, config.AirNowAPIKey), nil
+	}
+	return nil, fmt.Errorf("unknown air quality provider %q", config.Provider)
+}
+
+// aqiBreakpoint maps a range of concentrations of a pollutant to a range of the AQI
+type aqiBreakpoint struct {
+	low, high       float64
+	aqiLow, aqiHigh int
+}
+
+// EPA breakpoints of PM2.5 in µg/m³, as revised in 2024, and of PM10 in µg/m³
+var (
+	pm25Breakpoints = []aqiBreakpoint{
+		{0, 9, 0, 50},
+		{9.1, 35.4, 51, 100},
+		{35.5, 55.4, 101, 150},
+		{55.5, 125.4, 151, 200},
+		{125.5, 225.4, 201, 300},
+		{225.5, 325.4, 301, 500},
+	}
+	pm10Breakpoints = []aqiBreakpoint{
+		{0, 54, 0, 50},
+		{55, 154, 51, 100},
+		{155, 254, 101, 150},
+		{255, 354, 151, 200},
+		{355, 424, 201, 300},
+		{425, 604, 301, 500},
+	}
+)
+
+// usAQI converts the concentration of a pollutant to the US AQI, concentrations above the
+// last breakpoint are 500
+func usAQI(concentration float64, breakpoints []aqiBreakpoint) int {
+	for i, bp := range breakpoints {
+		// concentrations between two breakpoints belong to the lower range
+		next := math.Inf(1)
+		if i+1 < len(breakpoints) {
+			next = breakpoints[i+1].low
+		}
+		if concentration < next {
+			concentration = min(concentration, bp.high)
+			return int(math.Round(float64(bp.aqiHigh-bp.aqiLow)/(bp.high-bp.low)*(concentration-bp.low) + float64(bp.aqiLow)))
+		}
+	}
+	return 500
+}
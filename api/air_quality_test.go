@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+)
+
+// renamingAirQuality returns a fixed AQI, renaming the park on the way like a park
+// update running at the same time
+type renamingAirQuality struct {
+	app *pocketbase.PocketBase
+}
+
+func (p renamingAirQuality) Name() string { return "test" }
+
+func (p renamingAirQuality) AirQuality(ctx context.Context, lat, lon string) (*AirQuality, error) {
+	_, err := p.app.Dao().DB().Update("parks", dbx.Params{"name": "Renamed"}, dbx.HashExp{"parkCode": "yose"}).Execute()
+	return &AirQuality{Provider: p.Name(), UpdatedAt: time.Now(), AQI: 42}, err
+}
+
+func TestFetchAndStoreAirQualityKeepsOtherFields(t *testing.T) {
+	app := newTestApp(t)
+	park := saveTestRecord(t, app, "parks", map[string]any{"parkCode": "yose", "name": "Yosemite"})
+
+	run := &JobRun{Id: "run", Job: JobUpdateAirQuality}
+	if err := FetchAndStoreAirQuality(context.Background(), app, renamingAirQuality{app}, run); err != nil {
+		t.Fatal(err)
+	}
+	park, err := app.Dao().FindRecordById("parks", park.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := park.GetString("name"); name != "Renamed" {
+		t.Errorf("name = %q, the concurrent update was overwritten", name)
+	}
+	if airQuality := LoadAirQuality(park); airQuality == nil || airQuality.AQI != 42 {
+		t.Errorf("LoadAirQuality() = %+v, want AQI 42", airQuality)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const airNowURL = "https://www.airnowapi.org/aq"
+
+// AirNow reads air quality from the AirNow API of the EPA, the official US AQI of the
+// monitors and forecasts of the reporting area nearest to a park. It only covers the US.
+type AirNow struct {
+	APIKey  string
+	BaseURL string
+	Client  *Client
+	// Distance is how far from the park, in miles, a reporting area may be
+	Distance int
+}
+
+func NewAirNow(client *Client, apiKey string) *AirNow {
+	return &AirNow{
+		APIKey:   apiKey,
+		BaseURL:  airNowURL,
+		Client:   client,
+		Distance: 50,
+	}
+}
+
+func (a *AirNow) Name() string {
+	return "airnow"
+}
+
+// airNowReading is an observation or forecast of a pollutant
+type airNowReading struct {
+	DateForecast  string `json:"DateForecast"`
+	ParameterName string `json:"ParameterName"`
+	// -1 when the forecast only has a category
+	AQI      int `json:"AQI"`
+	Category struct {
+		Number int `json:"Number"`
+	} `json:"Category"`
+}
+
+// aqi returns the AQI of a reading, or the lowest AQI of its category
+func (r airNowReading) aqi() int {
+	if r.AQI >= 0 {
+		return r.AQI
+	}
+	lowest := []int{0, 0, 51, 101, 151, 201, 301}
+	if r.Category.Number > 0 && r.Category.Number < len(lowest) {
+		return lowest[r.Category.Number]
+	}
+	return -1
+}
+
+func (a *AirNow) AirQuality(ctx context.Context, lat, lon string) (*AirQuality, error) {
+	var current []airNowReading
+	if err := a.get(ctx, "/observation/latLong/current/", lat, lon, &current); err != nil {
+		return nil, err
+	}
+	if len(current) == 0 {
+		return nil, fmt.Errorf("no AirNow reporting area within %d miles of %s,%s", a.Distance, lat, lon)
+	}
+	airQuality := &AirQuality{Provider: a.Name(), UpdatedAt: time.Now(), AQI: -1}
+	// the AQI of a place is that of its worst pollutant
+	for _, reading := range current {
+		if aqi := reading.aqi(); aqi > airQuality.AQI {
+			airQuality.AQI, airQuality.Pollutant = aqi, reading.ParameterName
+		}
+	}
+	if airQuality.AQI < 0 {
+		return nil, fmt.Errorf("no AQI observed at %s,%s", lat, lon)
+	}
+	var forecasts []airNowReading
+	if err := a.get(ctx, "/forecast/latLong/", lat, lon, &forecasts); err != nil {
+		return nil, err
+	}
+	// a forecast per pollutant and day, the days are local to the reporting area
+	days := map[string]int{}
+	for _, reading := range forecasts {
+		day, aqi := strings.TrimSpace(reading.DateForecast), reading.aqi()
+		if aqi < 0 {
+			continue
+		}
+		if previous, ok := days[day]; !ok || aqi > previous {
+			days[day] = aqi
+		}
+	}
+	for day, aqi := range days {
+		airQuality.Forecast = append(airQuality.Forecast, AQIDay{Day: day, AQI: aqi})
+	}
+	sort.Slice(airQuality.Forecast, func(i, j int) bool {
+		return airQuality.Forecast[i].Day < airQuality.Forecast[j].Day
+	})
+	return airQuality, nil
+}
+
+func (a *AirNow) get(ctx context.Context, path, lat, lon string, result any) error {
+	params := url.Values{}
+	params.Add("format", "application/json")
+	params.Add("latitude", lat)
+	params.Add("longitude", lon)
+	params.Add("distance", fmt.Sprint(a.Distance))
+	params.Add("API_KEY", a.APIKey)
+	resp, err := a.Client.Get(ctx, a.BaseURL+path+"?"+params.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch AirNow %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// severities of weather warnings, from the Common Alerting Protocol
+const (
+	SeverityExtreme  = "extreme"
+	SeveritySevere   = "severe"
+	SeverityModerate = "moderate"
+	SeverityMinor    = "minor"
+	SeverityUnknown  = "unknown"
+)
+
+var severityOrder = []string{SeverityExtreme, SeveritySevere, SeverityModerate, SeverityMinor, SeverityUnknown}
+
+// WeatherAlert is an official weather warning at a location, e.g. a Red Flag Warning
+type WeatherAlert struct {
+	Event       string
+	Headline    string
+	Description string
+	Severity    string
+	URL         string
+	Effective   time.Time
+	Expires     time.Time
+}
+
+// normalizeSeverity maps the severity of a provider to one of the severities above
+func normalizeSeverity(severity string) string {
+	severity = strings.ToLower(strings.TrimSpace(severity))
+	if slices.Contains(severityOrder, severity) {
+		return severity
+	}
+	return SeverityUnknown
+}
+
+// severityOfEvent guesses the severity of a warning without one from its name
+func severityOfEvent(event string) string {
+	event = strings.ToLower(event)
+	switch {
+	case strings.Contains(event, "warning"):
+		return SeveritySevere
+	case strings.Contains(event, "watch"):
+		return SeverityModerate
+	case strings.Contains(event, "advisory"), strings.Contains(event, "statement"):
+		return SeverityMinor
+	}
+	return SeverityUnknown
+}
+
+// saveWeatherAlerts replaces the weather warnings of a park with those of the forecast
+func saveWeatherAlerts(app *pocketbase.PocketBase, parkId string, forecast *Forecast) error {
+	if forecast.Alerts == nil {
+		return nil
+	}
+	collection, err := app.Dao().FindCollectionByNameOrId("alerts")
+	if err != nil {
+		return err
+	}
+	// the warnings of every weather provider, the fallback may have stored some
+	old, err := app.Dao().FindRecordsByExpr("alerts", dbx.HashExp{"park": parkId}, dbx.NotIn("source", "", "nps"))
+	if err != nil {
+		return err
+	}
+	for _, record := range old {
+		if err := app.Dao().DeleteRecord(record); err != nil {
+			return err
+		}
+	}
+	for _, alert := range forecast.Alerts {
+		record := models.NewRecord(collection)
+		record.Set("title", alert.Headline)
+		record.Set("description", alert.Description)
+		record.Set("category", alert.Event)
+		record.Set("url", alert.URL)
+		record.Set("park", parkId)
+		record.Set("source", forecast.Provider)
+		record.Set("severity", alert.Severity)
+		if !alert.Effective.IsZero() {
+			effective, _ := types.ParseDateTime(alert.Effective)
+			record.Set("effective", effective)
+		}
+		if !alert.Expires.IsZero() {
+			expires, _ := types.ParseDateTime(alert.Expires)
+			record.Set("expires", expires)
+		}
+		if err := app.Dao().SaveRecord(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ActiveAlerts returns the alerts of a park that haven't expired and are in effect during
+// the trip, if it has dates. Weather warnings come first by severity, then the park alerts.
+func ActiveAlerts(app *pocketbase.PocketBase, parkId string, trip TripDates) ([]Alert, error) {
+	records, err := app.Dao().FindRecordsByExpr("alerts", dbx.HashExp{"park": parkId})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var alerts []Alert
+	for _, record := range records {
+		alert := Alert{
+			Title:       record.GetString("title"),
+			Description: record.GetString("description"),
+			Category:    record.GetString("category"),
+			Url:         record.GetString("url"),
+			Source:      record.GetString("source"),
+			Severity:    record.GetString("severity"),
+			Effective:   record.GetDateTime("effective").Time(),
+			Expires:     record.GetDateTime("expires").Time(),
+		}
+		if !alert.Expires.IsZero() && alert.Expires.Before(now) || !trip.Overlaps(alert.Effective, alert.Expires) {
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	slices.SortStableFunc(alerts, func(a, b Alert) int {
+		return a.rank() - b.rank()
+	})
+	return alerts, nil
+}
+
+// IsWeather reports whether the alert is a weather warning
+func (a Alert) IsWeather() bool {
+	return a.Source != "" && a.Source != "nps"
+}
+
+func (a Alert) rank() int {
+	if !a.IsWeather() {
+		return len(severityOrder)
+	}
+	return slices.Index(severityOrder, normalizeSeverity(a.Severity))
+}
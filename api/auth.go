@@ -0,0 +1,62 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// APITokenHeader carries the signed API token of the refresh endpoints
+const APITokenHeader = "X-Api-Token"
+
+// SignAPIToken returns an API token valid until expires. The token is the expiry time in
+// unix seconds followed by its HMAC-SHA256 signature, so it can't be extended.
+func SignAPIToken(secret string, expires time.Time) string {
+	payload := strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + apiTokenSignature(secret, payload)
+}
+
+// VerifyAPIToken reports whether the token was signed with secret and has not expired
+func VerifyAPIToken(secret string, token string) bool {
+	if secret == "" {
+		return false
+	}
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(apiTokenSignature(secret, payload)))
+}
+
+func apiTokenSignature(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("parkpilot:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RequireAdminOrAPIToken only lets through PocketBase admins and requests with an API
+// token signed with secret. An empty secret disables API tokens.
+func RequireAdminOrAPIToken(secret string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if admin, _ := c.Get(apis.ContextAdminKey).(*models.Admin); admin != nil {
+				return next(c)
+			}
+			if VerifyAPIToken(secret, c.Request().Header.Get(APITokenHeader)) {
+				return next(c)
+			}
+			return apis.NewUnauthorizedError("The request requires admin authorization or a valid API token.", nil)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// ClimateMonth is the climate normal of a park for a month, in metric units. They are
+// imported from a file, as forecasts only cover the next days.
+type ClimateMonth struct {
+	// 1 for January
+	Month int
+	// average daily high and low temperatures
+	HighC float64
+	LowC  float64
+	// average precipitation of the month, and the number of days with at least 0.1 in
+	PrecipMm   float64
+	PrecipDays float64
+	SnowCm     float64
+}
+
+func (m ClimateMonth) Name() string {
+	return time.Month(m.Month).String()[:3]
+}
+
+func (m ClimateMonth) HighF() float64 {
+	return m.HighC*1.8 + 32
+}
+
+func (m ClimateMonth) LowF() float64 {
+	return m.LowC*1.8 + 32
+}
+
+func (m ClimateMonth) PrecipIn() float64 {
+	return m.PrecipMm / 25.4
+}
+
+func (m ClimateMonth) SnowIn() float64 {
+	return m.SnowCm / 2.54
+}
+
+// climateColumn is a column of a climate normals file, its value plus offset times scale
+// is the metric value of the field
+type climateColumn struct {
+	field  string
+	offset float64
+	scale  float64
+}
+
+// the columns of a climate normals file, by lowercase name. Files have either the columns of
+// our own format, in metric or imperial units, or those of the NOAA monthly normals.
+var climateColumns = map[string]climateColumn{
+	"highc":      {field: "highC", scale: 1},
+	"highf":      {field: "highC", offset: -32, scale: 5.0 / 9},
+	"lowc":       {field: "lowC", scale: 1},
+	"lowf":       {field: "lowC", offset: -32, scale: 5.0 / 9},
+	"precipmm":   {field: "precipMm", scale: 1},
+	"precipin":   {field: "precipMm", scale: 25.4},
+	"precipdays": {field: "precipDays", scale: 1},
+	"snowcm":     {field: "snowCm", scale: 1},
+	"snowin":     {field: "snowCm", scale: 2.54},
+	// NOAA 1991-2020 monthly normals, in standard units
+	"mly-tmax-normal":         {field: "highC", offset: -32, scale: 5.0 / 9},
+	"mly-tmin-normal":         {field: "lowC", offset: -32, scale: 5.0 / 9},
+	"mly-prcp-normal":         {field: "precipMm", scale: 25.4},
+	"mly-prcp-avgnds-ge010hi": {field: "precipDays", scale: 1},
+	"mly-snow-normal":         {field: "snowCm", scale: 2.54},
+}
+
+// climateValue parses a value of a climate normals file, NOAA marks missing and
+// unavailable values with -9999, -8888 and -6666 and traces with -7777
+func climateValue(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	switch value {
+	case "", "-9999", "-8888", "-6666":
+		return 0, false
+	case "-7777":
+		return 0, true
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	return v, err == nil
+}
+
+// ImportClimateNormals stores the monthly climate normals of a CSV file in the parkClimate
+// collection, replacing the normals of the same park and month. The park of each row is
+// read from its parkCode column, or is parkCode for files of a single station like the
+// NOAA ones. Rows that can't be imported are logged and skipped, it returns the number
+// of imported and skipped rows.
+func ImportClimateNormals(app *pocketbase.PocketBase, r io.Reader, parkCode string, source string) (imported int, skipped int, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading header: %w", err)
+	}
+	parkColumn, monthColumn := -1, -1
+	columns := map[int]climateColumn{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "parkcode":
+			parkColumn = i
+		case "month", "date":
+			monthColumn = i
+		default:
+			if column, ok := climateColumns[name]; ok {
+				columns[i] = column
+			}
+		}
+	}
+	if monthColumn < 0 {
+		return 0, 0, errors.New("no month column")
+	}
+	if parkColumn < 0 && parkCode == "" {
+		return 0, 0, errors.New("no parkCode column, the park of the file is needed")
+	}
+	collection, err := app.Dao().FindCollectionByNameOrId("parkClimate")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	parks := map[string]*models.Record{}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, skipped, fmt.Errorf("line %d: %w", line, err)
+		}
+		if monthColumn >= len(row) {
+			log.Printf("Skipping climate normals of line %d, no month", line)
+			skipped++
+			continue
+		}
+		code := strings.ToLower(parkCode)
+		if parkColumn >= 0 && parkColumn < len(row) && row[parkColumn] != "" {
+			code = strings.ToLower(strings.TrimSpace(row[parkColumn]))
+		}
+		park, ok := parks[code]
+		if !ok {
+			park, err = app.Dao().FindFirstRecordByData("parks", "parkCode", code)
+			if err != nil {
+				log.Printf("Skipping climate normals of line %d, park %q not found", line, code)
+			}
+			parks[code] = park
+		}
+		if park == nil {
+			skipped++
+			continue
+		}
+		// NOAA dates are the month number
+		month, err := strconv.Atoi(strings.TrimLeft(strings.TrimSpace(row[monthColumn]), "-"))
+		if err != nil || month < 1 || month > 12 {
+			log.Printf("Skipping climate normals of line %d, invalid month %q", line, row[monthColumn])
+			skipped++
+			continue
+		}
+		values := map[string]float64{}
+		for i, column := range columns {
+			if i >= len(row) {
+				continue
+			}
+			if v, ok := climateValue(row[i]); ok {
+				values[column.field] = (v + column.offset) * column.scale
+			}
+		}
+		_, hasHigh := values["highC"]
+		_, hasLow := values["lowC"]
+		if !hasHigh || !hasLow {
+			log.Printf("Skipping climate normals of line %d, no temperatures", line)
+			skipped++
+			continue
+		}
+
+		record, err := app.Dao().FindFirstRecordByFilter("parkClimate", "park = {:park} && month = {:month}",
+			dbx.Params{"park": park.Id, "month": month})
+		if errors.Is(err, sql.ErrNoRows) {
+			record = models.NewRecord(collection)
+			record.Set("park", park.Id)
+			record.Set("month", month)
+		} else if err != nil {
+			return imported, skipped, err
+		}
+		for _, field := range []string{"highC", "lowC", "precipMm", "precipDays", "snowCm"} {
+			record.Set(field, values[field])
+		}
+		record.Set("source", source)
+		if err := app.Dao().SaveRecord(record); err != nil {
+			log.Printf("Error saving climate normals of %s for month %d: %v", code, month, err)
+			skipped++
+			continue
+		}
+		imported++
+	}
+	return imported, skipped, nil
+}
+
+// LoadClimate returns the climate normals of a park by month, it has none if they
+// haven't been imported
+func LoadClimate(app *pocketbase.PocketBase, parkId string) ([]ClimateMonth, error) {
+	records, err := app.Dao().FindRecordsByFilter("parkClimate", "park = {:park}", "month", 0, 0, dbx.Params{"park": parkId})
+	if err != nil {
+		return nil, err
+	}
+	months := make([]ClimateMonth, 0, len(records))
+	for _, record := range records {
+		months = append(months, ClimateMonth{
+			Month:      record.GetInt("month"),
+			HighC:      record.GetFloat("highC"),
+			LowC:       record.GetFloat("lowC"),
+			PrecipMm:   record.GetFloat("precipMm"),
+			PrecipDays: record.GetFloat("precipDays"),
+			SnowCm:     record.GetFloat("snowCm"),
+		})
+	}
+	return months, nil
+}
+
+// TripClimate returns the climate normals of the months of a trip
+func TripClimate(climate []ClimateMonth, trip TripDates) []ClimateMonth {
+	from, errFrom := time.Parse(time.DateOnly, trip.From)
+	to, errTo := time.Parse(time.DateOnly, trip.To)
+	if errFrom != nil || errTo != nil {
+		return nil
+	}
+	var months []ClimateMonth
+	// a trip of a year or more has every month once
+	month := from.AddDate(0, 0, 1-from.Day())
+	for i := 0; i < 12 && !month.After(to); i++ {
+		for _, m := range climate {
+			if m.Month == int(month.Month()) {
+				months = append(months, m)
+			}
+		}
+		month = month.AddDate(0, 1, 0)
+	}
+	return months
+}
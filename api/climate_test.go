@@ -0,0 +1,66 @@
+package api
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestImportClimateNormals(t *testing.T) {
+	tests := []struct {
+		name     string
+		park     string
+		csv      string
+		want     []ClimateMonth
+		imported int
+		skipped  int
+	}{
+		{"imperial", "", `parkCode,month,highF,lowF,precipIn,precipDays,snowIn
+yose,7,86,50,0.5,2,0
+yose,13,86,50,0.5,2,0
+zzzz,7,86,50,0.5,2,0
+`, []ClimateMonth{{Month: 7, HighC: 30, LowC: 10, PrecipMm: 12.7, PrecipDays: 2}}, 1, 2},
+		{"metric", "", `parkCode, Month, HighC, LowC, PrecipMm, SnowCm
+YOSE,1,10,-2,150,40
+yose,2,12
+`, []ClimateMonth{{Month: 1, HighC: 10, LowC: -2, PrecipMm: 150, SnowCm: 40}}, 1, 1},
+		{"NOAA with sentinels", "yose", `STATION,DATE,MLY-TMAX-NORMAL,MLY-TMIN-NORMAL,MLY-PRCP-NORMAL,MLY-PRCP-AVGNDS-GE010HI,MLY-SNOW-NORMAL
+USC00049855,01,50.0,32.0,-7777,3,-9999
+USC00049855,02,-8888,30.0,1.0,3,2.0
+USC00049855,03,55.0,-6666,1.0,3,2.0
+USC00049855,04,-9999,-9999,-9999,-9999,-9999
+`, []ClimateMonth{{Month: 1, HighC: 10, LowC: 0, PrecipDays: 3}}, 1, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(t)
+			park := saveTestRecord(t, app, "parks", map[string]any{"parkCode": "yose"})
+
+			imported, skipped, err := ImportClimateNormals(app, strings.NewReader(test.csv), test.park, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if imported != test.imported || skipped != test.skipped {
+				t.Errorf("ImportClimateNormals() = %d imported, %d skipped, want %d and %d", imported, skipped, test.imported, test.skipped)
+			}
+			months, err := LoadClimate(app, park.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(months) != len(test.want) {
+				t.Fatalf("LoadClimate() = %+v, want %+v", months, test.want)
+			}
+			for i, month := range months {
+				want := test.want[i]
+				if month.Month != want.Month || !near(month.HighC, want.HighC) || !near(month.LowC, want.LowC) ||
+					!near(month.PrecipMm, want.PrecipMm) || !near(month.PrecipDays, want.PrecipDays) || !near(month.SnowCm, want.SnowCm) {
+					t.Errorf("month %d = %+v, want %+v", i, month, want)
+				}
+			}
+		})
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
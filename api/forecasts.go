@@ -0,0 +1,130 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// hourly forecasts older than this are deleted when a park gets a new one
+const hourlyForecastRetention = 48 * time.Hour
+
+// WeatherHour is the forecast of a single hour. Hourly forecasts are stored in the
+// forecasts collection rather than in the park, so only numbers in metric units are kept.
+type WeatherHour struct {
+	// unix time of the start of the hour
+	Time         int64   `json:"t"`
+	TemperatureC float64 `json:"c"`
+	// chance of precipitation in percent
+	PrecipProbability float64 `json:"p"`
+	WindKmh           float64 `json:"w"`
+}
+
+func (h WeatherHour) TemperatureF() float64 {
+	return h.TemperatureC*1.8 + 32
+}
+
+func (h WeatherHour) WindMph() float64 {
+	return h.WindKmh / 1.609344
+}
+
+// HourlyForecast is the latest hourly forecast of a park
+type HourlyForecast struct {
+	Provider string
+	IssuedAt time.Time
+	// the park's time zone, used for the hours shown on the chart
+	Location *time.Location
+	Hours    []WeatherHour
+}
+
+// LocalTime returns the start of an hour in the time zone of the park
+func (f HourlyForecast) LocalTime(hour WeatherHour) time.Time {
+	return time.Unix(hour.Time, 0).In(f.Location)
+}
+
+// saveHourlyForecast stores the hourly forecast of a park, unless the provider
+// hasn't issued a new one since the last run
+func saveHourlyForecast(app *pocketbase.PocketBase, parkId string, forecast *Forecast) error {
+	if len(forecast.Hourly) == 0 {
+		return nil
+	}
+	issuedAt := forecast.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+	issued, err := types.ParseDateTime(issuedAt)
+	if err != nil {
+		return err
+	}
+	_, err = app.Dao().FindFirstRecordByFilter("forecasts", "park = {:park} && issuedAt = {:issuedAt}",
+		dbx.Params{"park": parkId, "issuedAt": issued.String()})
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	collection, err := app.Dao().FindCollectionByNameOrId("forecasts")
+	if err != nil {
+		return err
+	}
+	record := models.NewRecord(collection)
+	record.Set("park", parkId)
+	record.Set("issuedAt", issued)
+	record.Set("provider", forecast.Provider)
+	record.Set("utcOffset", forecast.UTCOffset)
+	record.Set("hours", forecast.Hourly)
+	if err := app.Dao().SaveRecord(record); err != nil {
+		return err
+	}
+	// forecasts of the last days are kept, older ones are of no use
+	before, err := types.ParseDateTime(time.Now().Add(-hourlyForecastRetention))
+	if err != nil {
+		return err
+	}
+	old, err := app.Dao().FindRecordsByFilter("forecasts", "park = {:park} && issuedAt < {:before}", "", 0, 0,
+		dbx.Params{"park": parkId, "before": before.String()})
+	if err != nil {
+		return err
+	}
+	for _, record := range old {
+		if err := app.Dao().DeleteRecord(record); err != nil {
+			return fmt.Errorf("deleting old forecast: %w", err)
+		}
+	}
+	return nil
+}
+
+// LatestHourlyForecast returns the next 48 hours of the latest hourly forecast of a park.
+// It has no hours if the park has no forecast yet.
+func LatestHourlyForecast(app *pocketbase.PocketBase, parkId string) (HourlyForecast, error) {
+	records, err := app.Dao().FindRecordsByFilter("forecasts", "park = {:park}", "-issuedAt", 1, 0, dbx.Params{"park": parkId})
+	if err != nil || len(records) == 0 {
+		return HourlyForecast{Location: time.UTC}, err
+	}
+	record := records[0]
+	offset := record.GetInt("utcOffset")
+	forecast := HourlyForecast{
+		Provider: record.GetString("provider"),
+		IssuedAt: record.GetDateTime("issuedAt").Time(),
+		Location: time.FixedZone("", offset),
+	}
+	var hours []WeatherHour
+	if err := record.UnmarshalJSONField("hours", &hours); err != nil {
+		return forecast, err
+	}
+	// the current hour and the next ones
+	now := time.Now().Truncate(time.Hour).Unix()
+	for _, hour := range hours {
+		if hour.Time >= now && len(forecast.Hours) < 48 {
+			forecast.Hours = append(forecast.Hours, hour)
+		}
+	}
+	return forecast, nil
+}
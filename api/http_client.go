@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// HostPolicy configures the requests made to a single host.
+type HostPolicy struct {
+	// Timeout of a single attempt, including reading the response body
+	Timeout time.Duration
+	// Rate and Burst configure the token bucket of the host, a zero Rate disables it
+	Rate  rate.Limit
+	Burst int
+}
+
+// DefaultHostPolicies returns the policies for the APIs used by parkpilot,
+// the "" key is used for every other host.
+func DefaultHostPolicies() map[string]HostPolicy {
+	return map[string]HostPolicy{
+		// NPS allows 1000 requests per hour per API key
+		"developer.nps.gov": {Timeout: 30 * time.Second, Rate: rate.Every(time.Hour / 1000), Burst: 10},
+		// park and campground photos, some of them are larger than 10MB
+		"www.nps.gov": {Timeout: 2 * time.Minute, Rate: 4, Burst: 4},
+		// OpenWeatherMap allows 60 calls per minute
+		"api.openweathermap.org": {Timeout: 20 * time.Second, Rate: rate.Every(time.Minute / 60), Burst: 10},
+		// the National Weather Service doesn't publish its limit
+		"api.weather.gov": {Timeout: 20 * time.Second, Rate: 5, Burst: 5},
+		// AirNow allows 500 requests per hour per API key
+		"www.airnowapi.org": {Timeout: 20 * time.Second, Rate: rate.Every(time.Hour / 500), Burst: 10},
+		// Mapbox Matrix and Static Images APIs
+		"api.mapbox.com": {Timeout: 20 * time.Second, Rate: rate.Every(time.Minute / 60), Burst: 10},
+		"":               {Timeout: time.Minute},
+	}
+}
+
+// Client is the shared HTTP client for all outbound API calls. Each attempt times out
+// according to the policy of its host and waits for the host's token bucket. Responses
+// with status 429 or 5xx and transport errors are retried with exponential backoff,
+// honoring the Retry-After header.
+type Client struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+
+	http     *http.Client
+	policies map[string]HostPolicy
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func NewClient(policies map[string]HostPolicy) *Client {
+	return &Client{
+		MaxRetries: 3,
+		BaseDelay:  time.Second,
+		MaxDelay:   2 * time.Minute,
+		http:       &http.Client{},
+		policies:   policies,
+		limiters:   map[string]*rate.Limiter{},
+	}
+}
+
+// Get issues a GET request to the given URL
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends a request without a body, retrying it if needed.
+// The caller must close the body of the returned response.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	policy := c.policy(req.URL.Hostname())
+	limiter := c.limiter(req.URL.Hostname(), policy)
+	for attempt := 0; ; attempt++ {
+		if limiter != nil {
+			if err := limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+		ctx, cancel := req.Context(), context.CancelFunc(func() {})
+		if policy.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		}
+		start := time.Now()
+		resp, err := c.http.Do(req.Clone(ctx))
+		var wait time.Duration
+		if err != nil {
+			cancel()
+			// the error quotes the URL, which may hold an API key
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				urlErr.URL = redactURL(req.URL)
+			}
+			log.Printf("%s %s failed after %s: %v", req.Method, redactURL(req.URL), time.Since(start).Round(time.Millisecond), err)
+			if attempt >= c.MaxRetries || req.Context().Err() != nil {
+				return nil, err
+			}
+			wait = c.backoff(attempt)
+		} else {
+			log.Printf("%s %s %s in %s", req.Method, redactURL(req.URL), resp.Status, time.Since(start).Round(time.Millisecond))
+			if !retryable(resp.StatusCode) || attempt >= c.MaxRetries {
+				// the timeout also covers reading the body, so cancel it when the body is closed
+				resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+				return resp, nil
+			}
+			wait = c.retryAfter(resp, attempt)
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			cancel()
+		}
+		log.Printf("Retrying %s %s in %s", req.Method, redactURL(req.URL), wait)
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func (c *Client) policy(host string) HostPolicy {
+	if policy, ok := c.policies[host]; ok {
+		return policy
+	}
+	return c.policies[""]
+}
+
+func (c *Client) limiter(host string, policy HostPolicy) *rate.Limiter {
+	if policy.Rate == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	limiter, ok := c.limiters[host]
+	if !ok {
+		limiter = rate.NewLimiter(policy.Rate, max(policy.Burst, 1))
+		c.limiters[host] = limiter
+	}
+	return limiter
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	return min(time.Duration(float64(c.BaseDelay)*math.Pow(2, float64(attempt))), c.MaxDelay)
+}
+
+// retryAfter reads the Retry-After header in seconds or as a date, falling back to backoff
+func (c *Client) retryAfter(resp *http.Response, attempt int) time.Duration {
+	header := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds)*time.Second, c.MaxDelay)
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return min(max(time.Until(date), 0), c.MaxDelay)
+	}
+	return c.backoff(attempt)
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// redactURL hides API keys from the logs and errors
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for _, key := range []string{"api_key", "appid", "access_token", "API_KEY"} {
+		if query.Has(key) {
+			query.Set(key, "xxx")
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
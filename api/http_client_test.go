@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client without rate limits or timeouts, whose backoff is delay
+func newTestClient(delay time.Duration) *Client {
+	client := NewClient(map[string]HostPolicy{"": {}})
+	client.BaseDelay = delay
+	client.MaxDelay = delay
+	return client
+}
+
+// statusServer answers with the statuses in turn, the last one repeated, and counts the requests
+func statusServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		statuses []int
+		delay    time.Duration
+		want     int
+		requests int32
+	}{
+		// the backoff would wait an hour, Retry-After asks for no wait
+		{"Retry-After honored", http.Header{"Retry-After": {"0"}}, []int{http.StatusServiceUnavailable, http.StatusOK}, time.Hour, http.StatusOK, 2},
+		{"Retry-After date", http.Header{"Retry-After": {time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}}, []int{http.StatusTooManyRequests, http.StatusOK}, time.Hour, http.StatusOK, 2},
+		{"no retry on 4xx", nil, []int{http.StatusNotFound}, time.Hour, http.StatusNotFound, 1},
+		{"gives up after max retries", nil, []int{http.StatusInternalServerError}, time.Millisecond, http.StatusInternalServerError, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := statusServer(t, test.header, test.statuses...)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			resp, err := newTestClient(test.delay).Get(ctx, server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.want || requests.Load() != test.requests {
+				t.Errorf("Get() = %d after %d requests, want %d after %d", resp.StatusCode, requests.Load(), test.want, test.requests)
+			}
+		})
+	}
+}
+
+func TestClientRedactsKeys(t *testing.T) {
+	var logs bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(output) })
+
+	server, _ := statusServer(t, nil, http.StatusOK)
+	client := newTestClient(time.Millisecond)
+	resp, err := client.Get(context.Background(), server.URL+"?appid=secret&q=yose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// a closed server fails in the transport, the error quotes the URL
+	server.Close()
+	client.MaxRetries = 0
+	_, err = client.Get(context.Background(), server.URL+"?api_key=secret")
+	if err == nil {
+		t.Fatal("Get() from a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q contains the API key", err)
+	}
+	if strings.Contains(logs.String(), "secret") || !strings.Contains(logs.String(), "q=yose") {
+		t.Errorf("logs %q contain the API key or miss the query", logs.String())
+	}
+}
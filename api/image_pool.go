@@ -0,0 +1,298 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"golang.org/x/sync/semaphore"
+)
+
+// largest image download accepted by the pool
+const maxImageDownload = 64 << 20
+
+// ImagePool downloads, decodes and resizes images concurrently. Workers reserve the
+// memory of the image they read before reading it, and the memory their decode buffers
+// need before decoding, so a batch of large photos waits for memory instead of
+// exhausting it. Reads and decodes have their own share of the budget: a worker holding
+// the data it read while it waits to decode can't block the workers that are decoding.
+type ImagePool struct {
+	client  *Client
+	workers *semaphore.Weighted
+	// memory of the images read and not decoded yet
+	reads      *semaphore.Weighted
+	readBudget int64
+	// memory of the decoded images and their resized copies
+	memory *semaphore.Weighted
+	budget int64
+}
+
+// NewImagePool creates a pool running at most workers downloads at once and using at
+// most memoryBudget bytes for the images it reads and decodes, a quarter of it for the
+// images read.
+func NewImagePool(client *Client, workers int, memoryBudget int64) *ImagePool {
+	readBudget := memoryBudget / 4
+	return &ImagePool{
+		client:     client,
+		workers:    semaphore.NewWeighted(int64(max(workers, 1))),
+		reads:      semaphore.NewWeighted(readBudget),
+		readBudget: readBudget,
+		memory:     semaphore.NewWeighted(memoryBudget - readBudget),
+		budget:     memoryBudget - readBudget,
+	}
+}
+
+// imageJob is a single image to process, downloaded from a provider or read from storage
+type imageJob struct {
+	// url or stored file name of the image
+	source string
+	// open returns the data of the image and its size, -1 when it isn't known
+	open func(ctx context.Context) (io.ReadCloser, int64, error)
+	// stored images are only used to create the missing variants
+	stored bool
+}
+
+type processedImage struct {
+	Source string
+	// the resized image, nil for images that are already stored
+	File     *filesystem.File
+	Width    int
+	Height   int
+	Variants []processedVariant
+	// WebP copies of the image and its variants, smallest first
+	WebP        []processedVariant
+	Placeholder string
+	Color       string
+	Hash        string
+}
+
+type processedVariant struct {
+	File  *filesystem.File
+	Width int
+}
+
+// Download downloads the given images and resizes them to maxWidth, along with their
+// smaller variants. The result keeps the order of urls, images that fail are logged and left out.
+// Images not started yet when ctx is done are left out as well.
+func (p *ImagePool) Download(ctx context.Context, label string, urls []string, maxWidth int) []processedImage {
+	jobs := make([]imageJob, 0, len(urls))
+	for _, imageURL := range urls {
+		jobs = append(jobs, imageJob{
+			source: imageURL,
+			open: func(ctx context.Context) (io.ReadCloser, int64, error) {
+				return p.download(ctx, imageURL)
+			},
+		})
+	}
+	return p.process(ctx, label, jobs, maxWidth)
+}
+
+// Variants creates the smaller variants of images that are already stored in the record
+// with the given base files path.
+func (p *ImagePool) Variants(ctx context.Context, label string, fs *filesystem.System, basePath string, files []string) []processedImage {
+	jobs := make([]imageJob, 0, len(files))
+	for _, file := range files {
+		jobs = append(jobs, imageJob{
+			source: file,
+			stored: true,
+			open: func(ctx context.Context) (io.ReadCloser, int64, error) {
+				r, err := fs.GetFile(basePath + "/" + file)
+				if err != nil {
+					return nil, 0, err
+				}
+				return r, r.Size(), nil
+			},
+		})
+	}
+	return p.process(ctx, label, jobs, 0)
+}
+
+func (p *ImagePool) process(ctx context.Context, label string, jobs []imageJob, maxWidth int) []processedImage {
+	results := make([]*processedImage, len(jobs))
+	var wg sync.WaitGroup
+	var done atomic.Int32
+	for i, job := range jobs {
+		if err := p.workers.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer p.workers.Release(1)
+			result, err := p.resize(ctx, job, maxWidth)
+			log.Printf("%s: processed image %d/%d", label, done.Add(1), len(jobs))
+			if err != nil {
+				log.Printf("Error resizing image %s: %v", job.source, err)
+				return
+			}
+			if result.File != nil {
+				log.Printf("Adding img to %s: %f kb", label, float64(result.File.Size)/1024.0)
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	// drop failed images
+	var processed []processedImage
+	for _, result := range results {
+		if result != nil {
+			processed = append(processed, *result)
+		}
+	}
+	return processed
+}
+
+func (p *ImagePool) resize(ctx context.Context, job imageJob, maxWidth int) (*processedImage, error) {
+	data, reserved, err := p.read(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	// the data is kept until it is decoded
+	defer func() {
+		if reserved > 0 {
+			p.reads.Release(reserved)
+		}
+	}()
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	width := config.Width
+	if !job.stored && width > maxWidth {
+		width = maxWidth
+	}
+	// reserve room for the decoded image and the resized copies, 4 bytes per pixel each
+	decoded := int64(config.Width) * int64(config.Height) * 4
+	resized := int64(width) * int64(config.Height) * int64(width) / int64(config.Width) * 4
+	// an image larger than the whole budget runs alone
+	cost := min(decoded+2*resized, p.budget)
+	if err := p.memory.Acquire(ctx, cost); err != nil {
+		return nil, err
+	}
+	defer p.memory.Release(cost)
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	data = nil // free up memory
+	p.reads.Release(reserved)
+	reserved = 0
+	name := strings.TrimSuffix(path.Base(job.source), path.Ext(job.source))
+	main := scaleImage(img, width)
+	result := &processedImage{Source: job.source, Width: width, Height: main.Rect.Dy()}
+	if !job.stored {
+		resizedBytes, err := encodeJPEG(main)
+		if err != nil {
+			return nil, err
+		}
+		result.File, err = filesystem.NewFileFromBytes(resizedBytes, name+".jpg")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := result.addWebP(main, name, width); err != nil {
+		return nil, err
+	}
+	// the smaller copies are scaled from the resized image, the smallest one also gives the placeholder
+	smallest := image.Image(main)
+	for _, variantWidth := range slices.Backward(imageVariantWidths) {
+		if variantWidth >= width {
+			continue
+		}
+		variant := scaleImage(main, variantWidth)
+		variantBytes, err := encodeJPEG(variant)
+		if err != nil {
+			return nil, err
+		}
+		file, err := filesystem.NewFileFromBytes(variantBytes, fmt.Sprintf("%s_w%d.jpg", name, variantWidth))
+		if err != nil {
+			return nil, err
+		}
+		result.Variants = append(result.Variants, processedVariant{File: file, Width: variantWidth})
+		if err := result.addWebP(variant, name, variantWidth); err != nil {
+			return nil, err
+		}
+		smallest = variant
+	}
+	slices.Reverse(result.Variants)
+	slices.Reverse(result.WebP)
+	result.Placeholder, result.Color, err = placeholder(smallest)
+	if err != nil {
+		return nil, err
+	}
+	result.Hash = imageHash(smallest)
+	return result, nil
+}
+
+// addWebP adds the WebP copy of the image at a width, when WebP is supported
+func (r *processedImage) addWebP(img image.Image, name string, width int) error {
+	if !WebPSupported {
+		return nil
+	}
+	data, err := encodeWebP(img)
+	if err != nil {
+		return err
+	}
+	file, err := filesystem.NewFileFromBytes(data, fmt.Sprintf("%s_w%d.webp", name, width))
+	if err != nil {
+		return err
+	}
+	r.WebP = append(r.WebP, processedVariant{File: file, Width: width})
+	return nil
+}
+
+// read reads the data of an image once the memory it needs is reserved, the reservation
+// is returned with the data and must be released by the caller. Images of an unknown size
+// reserve the size of the largest image accepted.
+func (p *ImagePool) read(ctx context.Context, job imageJob) ([]byte, int64, error) {
+	r, size, err := job.open(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Close()
+	if size > maxImageDownload {
+		return nil, 0, fmt.Errorf("image is larger than %d MB", maxImageDownload>>20)
+	}
+	limit := size
+	if limit < 0 {
+		limit = maxImageDownload
+	}
+	// an image larger than the whole budget is read alone
+	reserved := min(limit, p.readBudget)
+	if err := p.reads.Acquire(ctx, reserved); err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err == nil && int64(len(data)) > limit {
+		err = fmt.Errorf("image is larger than %d bytes", limit)
+	}
+	if err != nil {
+		p.reads.Release(reserved)
+		return nil, 0, err
+	}
+	return data, reserved, nil
+}
+
+// download opens the response of an image, its size is the content length of the response
+func (p *ImagePool) download(ctx context.Context, imageURL string) (io.ReadCloser, int64, error) {
+	resp, err := p.client.Get(ctx, imageURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("failed to download image: %s", resp.Status)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math/bits"
+	"slices"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/image/draw"
+)
+
+// widths of the smaller copies stored next to each park and campground photo
+var imageVariantWidths = []int{480, 960}
+
+// ImageMeta describes a stored photo, it is kept in the "imageMeta" field of parks and
+// campgrounds and keyed by the file name in the "images" field.
+type ImageMeta struct {
+	File     string         `json:"file"`
+	Source   string         `json:"source,omitempty"`
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+	Variants []ImageVariant `json:"variants,omitempty"`
+	// WebP copies of the photo and its variants, smallest first, also in "imageVariants"
+	WebP []ImageVariant `json:"webp,omitempty"`
+	// tiny base64 JPEG and dominant color shown while the photo loads
+	Placeholder string `json:"placeholder,omitempty"`
+	Color       string `json:"color,omitempty"`
+	// perceptual hash of the photo, see imageHash
+	Hash string `json:"hash,omitempty"`
+	// urls of provider photos that turned out to be duplicates of this one
+	Aliases []string `json:"aliases,omitempty"`
+	// texts of the provider photo
+	Title   string `json:"title,omitempty"`
+	AltText string `json:"altText,omitempty"`
+	Caption string `json:"caption,omitempty"`
+	Credit  string `json:"credit,omitempty"`
+}
+
+// complete reports whether the metadata has everything the current ingestion computes,
+// incomplete photos are processed again on the next run
+func (m ImageMeta) complete() bool {
+	return m.Width > 0 && m.Height > 0 && m.Placeholder != "" && m.Color != "" && m.Hash != "" &&
+		(!WebPSupported || len(m.WebP) > 0)
+}
+
+// variantFiles returns the files of the JPEG and WebP copies of the photo
+func (m ImageMeta) variantFiles() []string {
+	var files []string
+	for _, variant := range slices.Concat(m.Variants, m.WebP) {
+		files = append(files, variant.File)
+	}
+	return files
+}
+
+// hasSource reports whether the photo was downloaded from the given url
+func (m ImageMeta) hasSource(url string) bool {
+	return m.Source == url || slices.Contains(m.Aliases, url)
+}
+
+// setDetails copies the texts of a provider photo
+func (m *ImageMeta) setDetails(image ProviderImage) {
+	m.Title, m.AltText, m.Caption, m.Credit = image.Title, image.AltText, image.Caption, image.Credit
+}
+
+// Alt returns the alternative text of the photo, falling back to its title
+func (m ImageMeta) Alt() string {
+	if m.AltText != "" {
+		return m.AltText
+	}
+	return m.Title
+}
+
+// ImageVariant is a smaller copy of a photo, stored in the "imageVariants" field
+type ImageVariant struct {
+	File  string `json:"file"`
+	Width int    `json:"width"`
+}
+
+// LoadImageMeta returns the metadata of the photos of a park or campground record
+func LoadImageMeta(record *models.Record) []ImageMeta {
+	var meta []ImageMeta
+	record.UnmarshalJSONField("imageMeta", &meta)
+	return meta
+}
+
+// FindImageMeta returns the metadata of a stored photo, or nil if it has none
+func FindImageMeta(meta []ImageMeta, file string) *ImageMeta {
+	i := slices.IndexFunc(meta, func(m ImageMeta) bool { return m.File == file })
+	if i < 0 {
+		return nil
+	}
+	return &meta[i]
+}
+
+// scaleImage scales an image down to the given width, keeping its aspect ratio
+func scaleImage(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+		return dst
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, bounds.Dy()*width/bounds.Dx()))
+	draw.CatmullRom.Scale(dst, dst.Rect, img, bounds, draw.Over, nil)
+	return dst
+}
+
+func encodeJPEG(img image.Image) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 82}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// width of the low quality placeholder of each photo
+const placeholderWidth = 16
+
+// placeholder returns a tiny JPEG of the image as a data URI, along with its dominant color
+func placeholder(img image.Image) (string, string, error) {
+	tiny := scaleImage(img, placeholderWidth)
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, tiny, &jpeg.Options{Quality: 50}); err != nil {
+		return "", "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), dominantColor(tiny), nil
+}
+
+// dominantColor returns the average of the most common color bucket of a (tiny) image
+func dominantColor(img *image.RGBA) string {
+	type bucket struct{ r, g, b, n int }
+	buckets := map[int]*bucket{}
+	var top *bucket
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r, g, b := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2])
+		// 4 bits per channel
+		key := r>>4<<8 | g>>4<<4 | b>>4
+		bk, ok := buckets[key]
+		if !ok {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.r, bk.g, bk.b, bk.n = bk.r+r, bk.g+g, bk.b+b, bk.n+1
+		if top == nil || bk.n > top.n {
+			top = bk
+		}
+	}
+	if top == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", top.r/top.n, top.g/top.n, top.b/top.n)
+}
+
+// photos whose hashes differ in at most this many bits are considered the same photo.
+// Resized or recompressed copies differ in a few bits, other shots of the same view can
+// differ in less than 10 and must be kept.
+const duplicateHashDistance = 5
+
+// imageHash returns the difference hash (dHash) of an image: the image is scaled down to
+// 9x8 gray pixels and every bit tells whether a pixel is brighter than its right neighbor.
+// Resized, recompressed or re-hosted copies of a photo get the same or a very close hash.
+func imageHash(img image.Image) string {
+	gray := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.CatmullRom.Scale(gray, gray.Rect, img, img.Bounds(), draw.Src, nil)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray.GrayAt(x, y).Y > gray.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// hashDistance returns the number of differing bits of two image hashes
+func hashDistance(a, b string) int {
+	x, errA := strconv.ParseUint(a, 16, 64)
+	y, errB := strconv.ParseUint(b, 16, 64)
+	if errA != nil || errB != nil {
+		return 64
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+// findDuplicate returns the metadata of a photo that looks the same as the one with the given hash
+func findDuplicate(meta []ImageMeta, hash string) *ImageMeta {
+	if hash == "" {
+		return nil
+	}
+	for i := range meta {
+		if meta[i].Hash != "" && hashDistance(meta[i].Hash, hash) <= duplicateHashDistance {
+			return &meta[i]
+		}
+	}
+	return nil
+}
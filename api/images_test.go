@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+// landscape draws a mountain ridge against the sky, pan moves the view to the right by a
+// fraction of its width
+func landscape(width, height int, pan float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		fx := float64(x)/float64(width) + pan
+		ridge := 0.45 + 0.12*math.Sin(fx*9) + 0.06*math.Sin(fx*23+1)
+		for y := 0; y < height; y++ {
+			fy := float64(y) / float64(height)
+			if fy < ridge {
+				v := uint8(140 + 100*fy)
+				img.SetRGBA(x, y, color.RGBA{v / 2, v * 3 / 4, v, 255})
+			} else {
+				v := uint8(90 - 60*(fy-ridge))
+				img.SetRGBA(x, y, color.RGBA{v / 2, v, v / 3, 255})
+			}
+		}
+	}
+	return img
+}
+
+// storedHash returns the hash of an image as ingestion computes it, on its smallest variant
+func storedHash(t *testing.T, img image.Image) string {
+	t.Helper()
+	data, err := encodeJPEG(scaleImage(img, imageVariantWidths[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return imageHash(decoded)
+}
+
+func TestFindDuplicate(t *testing.T) {
+	overlook := landscape(1500, 1000, 0)
+	stored := []ImageMeta{{File: "overlook.jpg", Hash: storedHash(t, overlook)}}
+
+	tests := []struct {
+		name      string
+		img       image.Image
+		duplicate bool
+	}{
+		// the same photo hosted at another url
+		{"resized copy", scaleImage(overlook, 1024), true},
+		// other shots of the same overlook, a few bits past the threshold
+		{"view panned by 1.5%", landscape(1500, 1000, 0.015), false},
+		{"view panned by 2%", landscape(1500, 1000, 0.02), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash := storedHash(t, test.img)
+			if got := findDuplicate(stored, hash) != nil; got != test.duplicate {
+				t.Errorf("duplicate = %v, want %v, distance %d", got, test.duplicate, hashDistance(stored[0].Hash, hash))
+			}
+		})
+	}
+}
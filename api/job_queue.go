@@ -0,0 +1,454 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// JobFunc does the work of a job, it should return soon after ctx is done
+type JobFunc func(ctx context.Context, run *JobRun) error
+
+// ErrJobActive is returned when queueing a job that is already queued or running
+var ErrJobActive = errors.New("job is already queued or running")
+
+var (
+	// cancellation causes of a running job
+	errJobCancelled = errors.New("job run was cancelled")
+	errQueueStopped = errors.New("job queue was stopped")
+)
+
+// JobQueue runs jobs queued by the cron scheduler, the cobra commands and the HTTP
+// triggers. The queue lives in the jobRuns collection, so it is shared with other
+// processes using the same database and survives restarts.
+//
+// A job is never queued twice and only one run of each job runs at a time, different
+// jobs run concurrently. Failed runs are queued again until MaxAttempts, waiting
+// RetryDelay, then twice as long for every further attempt. Running jobs keep a heartbeat,
+// runs whose heartbeat stops, e.g. because their process died, are queued again.
+type JobQueue struct {
+	MaxAttempts  int
+	RetryDelay   time.Duration
+	PollInterval time.Duration
+
+	app  *pocketbase.PocketBase
+	jobs map[string]JobFunc
+
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
+	wg      sync.WaitGroup
+	wake    chan struct{}
+	stop    context.CancelCauseFunc
+}
+
+// a running job whose heartbeat is older than this is considered dead
+const heartbeatInterval = 30 * time.Second
+const heartbeatTimeout = 4 * heartbeatInterval
+
+func NewJobQueue(app *pocketbase.PocketBase) *JobQueue {
+	return &JobQueue{
+		MaxAttempts:  3,
+		RetryDelay:   5 * time.Minute,
+		PollInterval: 15 * time.Second,
+		app:          app,
+		jobs:         map[string]JobFunc{},
+		running:      map[string]context.CancelCauseFunc{},
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Register sets the function running the given job
+func (q *JobQueue) Register(job string, fn JobFunc) {
+	q.jobs[job] = fn
+}
+
+// Enqueue queues a run of the job with the given parameters and returns its id. If the
+// job is already queued or running, the id of that run is returned with ErrJobActive.
+func (q *JobQueue) Enqueue(job string, trigger string, params map[string]any) (string, error) {
+	if _, ok := q.jobs[job]; !ok {
+		return "", fmt.Errorf("unknown job %s", job)
+	}
+	var id string
+	err := q.app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		active, err := txDao.FindFirstRecordByFilter("jobRuns", "job = {:job} && (status = {:queued} || status = {:running})",
+			dbx.Params{"job": job, "queued": JobQueued, "running": JobRunning})
+		if err == nil {
+			id = active.Id
+			return ErrJobActive
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		collection, err := txDao.FindCollectionByNameOrId("jobRuns")
+		if err != nil {
+			return err
+		}
+		record := models.NewRecord(collection)
+		record.Set("job", job)
+		record.Set("trigger", trigger)
+		record.Set("status", JobQueued)
+		record.Set("params", params)
+		record.Set("runAfter", types.NowDateTime())
+		if err := txDao.SaveRecord(record); err != nil {
+			return err
+		}
+		id = record.Id
+		return nil
+	})
+	if err != nil {
+		return id, err
+	}
+	log.Printf("Queued %s (%s)", job, trigger)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+// Cancel cancels a queued or running job run. Runs of other processes stop at their
+// next heartbeat.
+func (q *JobQueue) Cancel(id string) error {
+	record, err := q.app.Dao().FindRecordById("jobRuns", id)
+	if err != nil {
+		return err
+	}
+	switch record.GetString("status") {
+	case JobQueued:
+		record.Set("status", JobCancelled)
+		record.Set("finishedAt", types.NowDateTime())
+	case JobRunning:
+		record.Set("cancelRequested", true)
+	default:
+		return fmt.Errorf("job run %s is already %s", id, record.GetString("status"))
+	}
+	if err := q.app.Dao().SaveRecord(record); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if cancel, ok := q.running[id]; ok {
+		cancel(errJobCancelled)
+	}
+	return nil
+}
+
+// Start runs queued jobs in the background until Stop is called
+func (q *JobQueue) Start() {
+	ctx, stop := context.WithCancelCause(context.Background())
+	q.stop = stop
+	go func() {
+		ticker := time.NewTicker(q.PollInterval)
+		defer ticker.Stop()
+		for {
+			q.requeueDead()
+			q.runQueued(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-q.wake:
+			}
+		}
+	}()
+}
+
+// Stop stops the queue, running jobs are cancelled and queued again
+func (q *JobQueue) Stop() {
+	if q.stop == nil {
+		return
+	}
+	q.stop(errQueueStopped)
+	q.wg.Wait()
+}
+
+// RunNow queues a run of the job and runs it in this process, waiting for it to finish.
+// It is used by the cobra commands, which don't run the queue. A failed run that can be
+// retried is left queued for the server.
+func (q *JobQueue) RunNow(ctx context.Context, job string, trigger string, params map[string]any) error {
+	id, err := q.Enqueue(job, trigger, params)
+	if errors.Is(err, ErrJobActive) {
+		// a run that is already queued, e.g. by the cron scheduler or for a retry, is run
+		// here right away and with the parameters of this run
+		err = q.takeOver(id, trigger, params)
+	}
+	if err != nil {
+		return err
+	}
+	claimed, err := q.claim(id, job)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrJobActive
+	}
+	return q.execute(ctx, id)
+}
+
+// takeOver replaces the trigger and the parameters of a queued run and makes it due now.
+// A run that isn't queued anymore is left as it is.
+func (q *JobQueue) takeOver(id string, trigger string, params map[string]any) error {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	now := types.NowDateTime().String()
+	result, err := q.app.Dao().DB().NewQuery(`
+		UPDATE jobRuns
+		SET trigger = {:trigger}, params = {:params}, runAfter = {:now}, updated = {:now}
+		WHERE id = {:id} AND status = {:queued}
+	`).Bind(dbx.Params{"id": id, "trigger": trigger, "params": string(encoded), "now": now, "queued": JobQueued}).Execute()
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 1 {
+		log.Printf("Taking over queued run %s", id)
+	}
+	return nil
+}
+
+// runQueued starts the queued runs that are due, one per job
+func (q *JobQueue) runQueued(ctx context.Context) {
+	records, err := q.app.Dao().FindRecordsByFilter("jobRuns", "status = {:queued} && runAfter <= {:now}", "created", 0, 0,
+		dbx.Params{"queued": JobQueued, "now": types.NowDateTime().String()})
+	if err != nil {
+		log.Printf("Error reading the job queue: %v", err)
+		return
+	}
+	for _, record := range records {
+		if ctx.Err() != nil {
+			return
+		}
+		claimed, err := q.claim(record.Id, record.GetString("job"))
+		if err != nil {
+			log.Printf("Error starting %s run: %v", record.GetString("job"), err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.execute(ctx, record.Id)
+		}()
+	}
+}
+
+// claim marks a queued run as running, unless another run of the same job is running.
+// The check and the update are a single statement, so two processes never claim the same job.
+func (q *JobQueue) claim(id string, job string) (bool, error) {
+	now := types.NowDateTime().String()
+	result, err := q.app.Dao().DB().NewQuery(`
+		UPDATE jobRuns
+		SET status = {:running}, attempts = attempts + 1, startedAt = {:now}, heartbeatAt = {:now}, finishedAt = '', updated = {:now}
+		WHERE id = {:id} AND status = {:queued}
+			AND NOT EXISTS (SELECT 1 FROM jobRuns WHERE job = {:job} AND status = {:running})
+	`).Bind(dbx.Params{"id": id, "job": job, "now": now, "queued": JobQueued, "running": JobRunning}).Execute()
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// requeueDead queues the runs whose process stopped sending heartbeats again
+func (q *JobQueue) requeueDead() {
+	deadline, err := types.ParseDateTime(time.Now().Add(-heartbeatTimeout))
+	if err != nil {
+		return
+	}
+	records, err := q.app.Dao().FindRecordsByFilter("jobRuns", "status = {:running} && heartbeatAt < {:deadline}", "created", 0, 0,
+		dbx.Params{"running": JobRunning, "deadline": deadline.String()})
+	if err != nil {
+		log.Printf("Error reading the job queue: %v", err)
+		return
+	}
+	for _, record := range records {
+		log.Printf("%s run %s stopped sending heartbeats, queueing it again", record.GetString("job"), record.Id)
+		q.retry(record, errors.New("the process running the job stopped"))
+	}
+}
+
+// execute runs a claimed run and records its outcome
+func (q *JobQueue) execute(parent context.Context, id string) error {
+	record, err := q.app.Dao().FindRecordById("jobRuns", id)
+	if err != nil {
+		return err
+	}
+	run := &JobRun{Id: id, Job: record.GetString("job"), Trigger: record.GetString("trigger")}
+	record.UnmarshalJSONField("params", &run.params)
+	fn, ok := q.jobs[run.Job]
+	if !ok {
+		err := fmt.Errorf("unknown job %s", run.Job)
+		q.finish(record, run, JobFailed, err)
+		return err
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+	q.mu.Lock()
+	q.running[id] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, id)
+		q.mu.Unlock()
+	}()
+	go q.heartbeat(ctx, id, cancel)
+
+	log.Printf("Running %s (%s), attempt %d", run.Job, run.Trigger, record.GetInt("attempts"))
+	jobErr := fn(ctx, run)
+
+	// read the record again, it was updated by the heartbeats
+	if fresh, err := q.app.Dao().FindRecordById("jobRuns", id); err == nil {
+		record = fresh
+	}
+	switch {
+	case jobErr == nil && ctx.Err() == nil:
+		status := JobSucceeded
+		if run.Failures() > 0 {
+			status = JobPartial
+		}
+		q.finish(record, run, status, nil)
+	case errors.Is(context.Cause(ctx), errQueueStopped):
+		// the server is shutting down, run the job again on the next start
+		log.Printf("%s stopped, it will run again", run.Job)
+		record.Set("attempts", record.GetInt("attempts")-1)
+		q.retry(record, nil)
+	case ctx.Err() != nil:
+		q.finish(record, run, JobCancelled, context.Cause(ctx))
+	default:
+		q.saveCounts(record, run)
+		q.retry(record, jobErr)
+	}
+	return jobErr
+}
+
+// heartbeat keeps the run alive and cancels it when a cancellation was requested
+func (q *JobQueue) heartbeat(ctx context.Context, id string, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := q.app.Dao().DB().NewQuery("UPDATE jobRuns SET heartbeatAt = {:now} WHERE id = {:id}").
+			Bind(dbx.Params{"id": id, "now": types.NowDateTime().String()}).Execute(); err != nil {
+			log.Printf("Error saving heartbeat of job run %s: %v", id, err)
+		}
+		record, err := q.app.Dao().FindRecordById("jobRuns", id)
+		if err == nil && record.GetBool("cancelRequested") {
+			cancel(errJobCancelled)
+		}
+	}
+}
+
+// retry queues a failed run again, or marks it failed after the last attempt
+func (q *JobQueue) retry(record *models.Record, jobErr error) {
+	job := record.GetString("job")
+	attempts := record.GetInt("attempts")
+	if jobErr != nil {
+		record.Set("error", jobErr.Error())
+	}
+	if attempts >= q.MaxAttempts {
+		record.Set("status", JobFailed)
+		record.Set("finishedAt", types.NowDateTime())
+		log.Printf("%s failed after %d attempts: %v", job, attempts, jobErr)
+	} else {
+		delay := time.Duration(0)
+		if jobErr != nil {
+			delay = time.Duration(float64(q.RetryDelay) * math.Pow(2, float64(max(attempts-1, 0))))
+			log.Printf("%s failed: %v, retrying in %s", job, jobErr, delay)
+		}
+		runAfter, _ := types.ParseDateTime(time.Now().Add(delay))
+		record.Set("status", JobQueued)
+		record.Set("runAfter", runAfter)
+	}
+	if err := q.app.Dao().SaveRecord(record); err != nil {
+		log.Printf("Error recording %s run: %v", job, err)
+	}
+}
+
+func (q *JobQueue) finish(record *models.Record, run *JobRun, status string, jobErr error) {
+	run.mu.Lock()
+	log.Printf("%s %s: %d created, %d updated, %d failed", run.Job, status, run.created, run.updated, run.failed)
+	run.mu.Unlock()
+	record.Set("status", status)
+	record.Set("finishedAt", types.NowDateTime())
+	if jobErr != nil {
+		record.Set("error", jobErr.Error())
+	}
+	q.saveCounts(record, run)
+	if err := q.app.Dao().SaveRecord(record); err != nil {
+		log.Printf("Error recording %s run: %v", run.Job, err)
+	}
+}
+
+// saveCounts sets the counts of the latest attempt of a run
+func (q *JobQueue) saveCounts(record *models.Record, run *JobRun) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	record.Set("recordsCreated", run.created)
+	record.Set("recordsUpdated", run.updated)
+	record.Set("recordsFailed", run.failed)
+	record.Set("recordsUnchanged", run.unchanged)
+	record.Set("errors", run.errors)
+	record.Set("changes", run.changes)
+}
+
+// EnqueueHTTP returns a handler queueing a run of job. It responds right away with the
+// id of the run, whose progress is returned by JobStatusHTTP.
+func (q *JobQueue) EnqueueHTTP(job string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := q.Enqueue(job, TriggerHTTP, nil)
+		if errors.Is(err, ErrJobActive) {
+			return c.JSON(http.StatusConflict, map[string]string{"id": id, "error": err.Error()})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusAccepted, map[string]string{"id": id, "status": JobQueued})
+	}
+}
+
+// CancelHTTP returns a handler cancelling the run with the id of the path
+func (q *JobQueue) CancelHTTP() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := q.Cancel(c.PathParam("id")); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		run, err := FindJobRun(q.app, c.PathParam("id"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Job run not found"})
+		}
+		return c.JSON(http.StatusOK, run)
+	}
+}
+
+// JobStatusHTTP returns the recorded run with the id of the path
+func JobStatusHTTP(app *pocketbase.PocketBase) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		run, err := FindJobRun(app, c.PathParam("id"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Job run not found"})
+		}
+		return c.JSON(http.StatusOK, run)
+	}
+}
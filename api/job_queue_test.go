@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func newTestQueue(t *testing.T) *JobQueue {
+	t.Helper()
+	queue := NewJobQueue(newTestApp(t))
+	queue.RetryDelay = time.Hour
+	queue.Register("test", func(ctx context.Context, run *JobRun) error { return nil })
+	return queue
+}
+
+func findRun(t *testing.T, queue *JobQueue, id string) *models.Record {
+	t.Helper()
+	record, err := queue.app.Dao().FindRecordById("jobRuns", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestJobQueueClaimsOnce(t *testing.T) {
+	queue := newTestQueue(t)
+	id, err := queue.Enqueue("test", "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	claims := make(chan bool, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed, err := queue.claim(id, "test")
+			if err != nil {
+				t.Error(err)
+			}
+			claims <- claimed
+		}()
+	}
+	wg.Wait()
+	close(claims)
+	won := 0
+	for claimed := range claims {
+		if claimed {
+			won++
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d concurrent claims won, want 1", won)
+	}
+
+	// another run of the job isn't started while the first one runs
+	collection, err := queue.app.Dao().FindCollectionByNameOrId("jobRuns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := models.NewRecord(collection)
+	other.Set("job", "test")
+	other.Set("status", JobQueued)
+	if err := queue.app.Dao().SaveRecord(other); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := queue.claim(other.Id, "test"); err != nil || claimed {
+		t.Errorf("claim() of a second run = %v, %v, want false", claimed, err)
+	}
+}
+
+func TestJobQueueRequeuesDeadRuns(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		want     string
+	}{
+		{"queued again", 1, JobQueued},
+		{"failed after the last attempt", 3, JobFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := newTestQueue(t)
+			id, err := queue.Enqueue("test", "test", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claimed, err := queue.claim(id, "test"); err != nil || !claimed {
+				t.Fatalf("claim() = %v, %v", claimed, err)
+			}
+			stale, _ := types.ParseDateTime(time.Now().Add(-2 * heartbeatTimeout))
+			if _, err := queue.app.Dao().DB().Update("jobRuns",
+				dbx.Params{"heartbeatAt": stale.String(), "attempts": test.attempts}, dbx.HashExp{"id": id}).Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			queue.requeueDead()
+			record := findRun(t, queue, id)
+			if status := record.GetString("status"); status != test.want {
+				t.Errorf("status = %s, want %s", status, test.want)
+			}
+			if record.GetString("error") == "" {
+				t.Error("the run has no error")
+			}
+		})
+	}
+}
+
+func TestJobQueueRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     string
+		delay    time.Duration
+	}{
+		{1, JobQueued, time.Hour},
+		{2, JobQueued, 2 * time.Hour},
+		{3, JobFailed, 0},
+	}
+	for _, test := range tests {
+		queue := newTestQueue(t)
+		id, err := queue.Enqueue("test", "test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := findRun(t, queue, id)
+		record.Set("status", JobRunning)
+		record.Set("attempts", test.attempts)
+
+		queue.retry(record, errors.New("upstream is down"))
+		record = findRun(t, queue, id)
+		if status := record.GetString("status"); status != test.want {
+			t.Errorf("attempt %d: status = %s, want %s", test.attempts, status, test.want)
+		}
+		if test.want != JobQueued {
+			continue
+		}
+		delay := time.Until(record.GetDateTime("runAfter").Time())
+		if delay < test.delay-time.Minute || delay > test.delay {
+			t.Errorf("attempt %d: retried in %s, want %s", test.attempts, delay, test.delay)
+		}
+	}
+}
+
+func TestJobQueueRunNowSchedulesRetry(t *testing.T) {
+	queue := newTestQueue(t)
+	jobErr := errors.New("upstream is down")
+	queue.Register("failing", func(ctx context.Context, run *JobRun) error { return jobErr })
+
+	if err := queue.RunNow(context.Background(), "failing", "test", nil); !errors.Is(err, jobErr) {
+		t.Fatalf("RunNow() = %v, want %v", err, jobErr)
+	}
+	record, err := queue.app.Dao().FindFirstRecordByData("jobRuns", "job", "failing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.GetString("status") != JobQueued || record.GetInt("attempts") != 1 || record.GetString("error") != jobErr.Error() {
+		t.Errorf("run = %s after %d attempts with %q, want queued after 1 with %q",
+			record.GetString("status"), record.GetInt("attempts"), record.GetString("error"), jobErr)
+	}
+	if delay := time.Until(record.GetDateTime("runAfter").Time()); delay < 59*time.Minute {
+		t.Errorf("retried in %s, want an hour", delay)
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// ingestion jobs, the names are also used as cron job ids
+const (
+	JobUpdateParks      = "updateParks"
+	JobUpdateWeather    = "updateWeather"
+	JobUpdateAlerts     = "updateAlerts"
+	JobUpdateAirQuality = "updateAirQuality"
+)
+
+// what started a job run
+const (
+	TriggerCron = "cron"
+	TriggerCLI  = "cli"
+	TriggerHTTP = "http"
+)
+
+// status of a job run
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	// the job finished, but some records failed
+	JobPartial   = "partial"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// at most this many item errors and changes are kept per run
+const maxJobErrors = 500
+
+// JobError is the error of a single park, campground or alert of a job run
+type JobError struct {
+	Item  string `json:"item"`
+	Error string `json:"error"`
+}
+
+// JobChange lists the changed fields of a single park or campground of a job run
+type JobChange struct {
+	Item   string   `json:"item"`
+	Fields []string `json:"fields"`
+}
+
+// JobRun counts the records handled by a single run of a job, it is safe for concurrent use
+type JobRun struct {
+	Id      string
+	Job     string
+	Trigger string
+
+	params    map[string]json.RawMessage
+	mu        sync.Mutex
+	created   int
+	updated   int
+	failed    int
+	unchanged int
+	errors    []JobError
+	changes   []JobChange
+}
+
+// Param decodes the parameter the run was queued with into v, it returns false if
+// the parameter was not given
+func (r *JobRun) Param(key string, v any) bool {
+	raw, ok := r.params[key]
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		log.Printf("Invalid %s parameter of %s run: %v", key, r.Job, err)
+		return false
+	}
+	return true
+}
+
+// Created counts a new record
+func (r *JobRun) Created() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.created++
+}
+
+// Updated counts an existing record that was saved again
+func (r *JobRun) Updated() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updated++
+}
+
+// Saved counts a record saved by a form, depending on whether it was new
+func (r *JobRun) Saved(isNew bool) {
+	if isNew {
+		r.Created()
+	} else {
+		r.Updated()
+	}
+}
+
+// Unchanged counts a record that was skipped because the provider data didn't change
+func (r *JobRun) Unchanged() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unchanged++
+}
+
+// Changed keeps the fields that changed in a saved record
+func (r *JobRun) Changed(item string, fields []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.changes) < maxJobErrors {
+		r.changes = append(r.changes, JobChange{Item: item, Fields: fields})
+	}
+}
+
+// Fail counts a record that could not be stored and keeps its error
+func (r *JobRun) Fail(item string, err error) {
+	r.mu.Lock()
+	r.failed++
+	r.mu.Unlock()
+	r.Error(item, err)
+}
+
+// Failures returns the number of records that could not be stored
+func (r *JobRun) Failures() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failed
+}
+
+// Error keeps the error of an item that was stored anyway, e.g. a missing image
+func (r *JobRun) Error(item string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errors) < maxJobErrors {
+		r.errors = append(r.errors, JobError{Item: item, Error: err.Error()})
+	}
+}
+
+// JobRunSummary is a recorded job run, as shown on the admin jobs page and the job status endpoint
+type JobRunSummary struct {
+	Id              string      `json:"id"`
+	Job             string      `json:"job"`
+	Trigger         string      `json:"trigger"`
+	Status          string      `json:"status"`
+	Attempts        int         `json:"attempts"`
+	CancelRequested bool        `json:"cancelRequested"`
+	QueuedAt        time.Time   `json:"queuedAt"`
+	StartedAt       time.Time   `json:"startedAt"`
+	FinishedAt      time.Time   `json:"finishedAt"`
+	Created         int         `json:"created"`
+	Updated         int         `json:"updated"`
+	Failed          int         `json:"failed"`
+	Unchanged       int         `json:"unchanged"`
+	Errors          []JobError  `json:"errors"`
+	Changes         []JobChange `json:"changes"`
+	Error           string      `json:"error,omitempty"`
+}
+
+// Active reports whether the run is queued or running
+func (s JobRunSummary) Active() bool {
+	return s.Status == JobQueued || s.Status == JobRunning
+}
+
+// Duration returns how long the run took, or has been running
+func (s JobRunSummary) Duration() time.Duration {
+	if s.StartedAt.IsZero() {
+		return 0
+	}
+	if s.FinishedAt.IsZero() {
+		return time.Since(s.StartedAt).Round(time.Second)
+	}
+	return s.FinishedAt.Sub(s.StartedAt).Round(time.Second)
+}
+
+// RecentJobRuns returns the latest queued job runs, newest first
+func RecentJobRuns(app *pocketbase.PocketBase, limit int) ([]JobRunSummary, error) {
+	records, err := app.Dao().FindRecordsByFilter("jobRuns", "id != ''", "-created", limit, 0)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]JobRunSummary, 0, len(records))
+	for _, record := range records {
+		runs = append(runs, jobRunSummary(record))
+	}
+	return runs, nil
+}
+
+// FindJobRun returns a recorded job run by id
+func FindJobRun(app *pocketbase.PocketBase, id string) (JobRunSummary, error) {
+	record, err := app.Dao().FindRecordById("jobRuns", id)
+	if err != nil {
+		return JobRunSummary{}, err
+	}
+	return jobRunSummary(record), nil
+}
+
+func jobRunSummary(record *models.Record) JobRunSummary {
+	run := JobRunSummary{
+		Id:              record.Id,
+		Job:             record.GetString("job"),
+		Trigger:         record.GetString("trigger"),
+		Status:          record.GetString("status"),
+		Attempts:        record.GetInt("attempts"),
+		CancelRequested: record.GetBool("cancelRequested"),
+		QueuedAt:        record.Created.Time(),
+		StartedAt:       record.GetDateTime("startedAt").Time(),
+		FinishedAt:      record.GetDateTime("finishedAt").Time(),
+		Created:         record.GetInt("recordsCreated"),
+		Updated:         record.GetInt("recordsUpdated"),
+		Failed:          record.GetInt("recordsFailed"),
+		Unchanged:       record.GetInt("recordsUnchanged"),
+		Error:           record.GetString("error"),
+	}
+	record.UnmarshalJSONField("errors", &run.Errors)
+	record.UnmarshalJSONField("changes", &run.Changes)
+	return run
+}
@@ -1,17 +1,35 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"math"
 	"net/http"
 	"os"
 	"sort"
 	"strconv"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
 )
 
+// the Matrix API takes at most 25 coordinates per request, the start and 24 parks
+const matrixMaxDestinations = 24
+
+// matrixURL is the Matrix API endpoint of driving distances, a variable for the tests
+var matrixURL = "https://api.mapbox.com/directions-matrix/v1/mapbox/driving/"
+
+// at most this many Matrix requests run at a time, the client keeps them within the
+// rate limit of Mapbox
+const matrixConcurrency = 4
+
 // FetchDrivingDistances fetches driving distances using the Mapbox Matrix API and sorts by Haversine distance.
-func FetchDrivingDistances(startCoordinates [2]float64, parksData []Park, count int) ([]Park, error) {
+// The closest parks are split in batches of a single request each, the parks of a batch that fails
+// are kept with an unknown drive, see Park.HasDrive. It only fails if every batch does.
+func FetchDrivingDistances(ctx context.Context, client *Client, startCoordinates [2]float64, parksData []Park, count int) ([]Park, error) {
 	// Calculate Haversine distance for each park and sort
 	for i := range parksData {
 		latitude, _ := strconv.ParseFloat(parksData[i].Latitude, 64)
@@ -28,30 +46,63 @@ func FetchDrivingDistances(startCoordinates [2]float64, parksData []Park, count
 		parksData = parksData[:count+4]
 	}
 
-	// Mapbox Matrix API call for driving distances
+	// Mapbox Matrix API calls for driving distances, one per batch
 	mapboxAccessToken := os.Getenv("MAPBOX_ACCESS_TOKEN")
+	errs := make([]error, (len(parksData)+matrixMaxDestinations-1)/matrixMaxDestinations)
+	sem := semaphore.NewWeighted(matrixConcurrency)
+	var wg sync.WaitGroup
+	for b := range errs {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			errs[b] = err
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+			batch := parksData[b*matrixMaxDestinations : min((b+1)*matrixMaxDestinations, len(parksData))]
+			errs[b] = fetchMatrix(ctx, client, mapboxAccessToken, startCoordinates, batch)
+		}()
+	}
+	wg.Wait()
+
+	// the parks of the failed batches keep an unknown drive
+	var failed []error
+	for b, err := range errs {
+		batch := parksData[b*matrixMaxDestinations : min((b+1)*matrixMaxDestinations, len(parksData))]
+		if err != nil {
+			log.Printf("Failed to fetch driving distances of %d parks, their drive is unknown: %v", len(batch), err)
+			failed = append(failed, err)
+			for i := range batch {
+				batch[i].DriveTime, batch[i].DrivingDistanceMi, batch[i].DrivingDistanceKm = "", "", ""
+			}
+		}
+	}
+	if len(failed) > 0 && len(failed) == len(errs) {
+		return nil, errors.Join(failed...)
+	}
+	return parksData[:min(count, len(parksData))], nil
+}
+
+// fetchMatrix attaches the driving distances from the start to a batch of parks,
+// from a single Matrix request
+func fetchMatrix(ctx context.Context, client *Client, accessToken string, startCoordinates [2]float64, parks []Park) error {
 	// Construct the coordinates part of the URL
 	coordinates := fmt.Sprintf("%f,%f", startCoordinates[1], startCoordinates[0]) // Starting point
-	for _, park := range parksData {
+	for _, park := range parks {
 		coordinates += ";" + park.Longitude + "," + park.Latitude // Destination points
 	}
 	// Construct the full URL with all parameters
-	url := fmt.Sprintf("https://api.mapbox.com/directions-matrix/v1/mapbox/driving/%s?sources=0&annotations=duration,distance&access_token=%s", coordinates, mapboxAccessToken)
+	url := fmt.Sprintf("%s%s?sources=0&annotations=duration,distance&access_token=%s", matrixURL, coordinates, accessToken)
 
 	// Make a GET request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := client.Get(ctx, url)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch data: %s", resp.Status)
+		return fmt.Errorf("failed to fetch data: %s", resp.Status)
 	}
 
 	var response struct {
@@ -59,21 +110,25 @@ func FetchDrivingDistances(startCoordinates [2]float64, parksData []Park, count
 		Distances [][]float64 `json:"distances"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
+		return err
+	}
+	if len(response.Durations) == 0 || len(response.Durations[0]) != len(parks)+1 ||
+		len(response.Distances) == 0 || len(response.Distances[0]) != len(parks)+1 {
+		return fmt.Errorf("unexpected matrix size for %d parks", len(parks))
 	}
 
 	// Attach driving distances to parks
-	for i := range parksData {
+	for i := range parks {
 		if response.Durations[0][i+1] == 0.0 {
-			parksData[i].DriveTime = ""
-			parksData[i].DrivingDistanceMi, parksData[i].DrivingDistanceKm = "ocean", "ocean"
+			parks[i].DriveTime = ""
+			parks[i].DrivingDistanceMi, parks[i].DrivingDistanceKm = "ocean", "ocean"
 		} else {
-			parksData[i].DriveTime = convertSeconds(response.Durations[0][i+1])
-			parksData[i].DrivingDistanceMi = convertMetres(response.Distances[0][i+1], true)  // +1 to skip the start location
-			parksData[i].DrivingDistanceKm = convertMetres(response.Distances[0][i+1], false) // +1 to skip the start location
+			parks[i].DriveTime = convertSeconds(response.Durations[0][i+1])
+			parks[i].DrivingDistanceMi = convertMetres(response.Distances[0][i+1], true)  // +1 to skip the start location
+			parks[i].DrivingDistanceKm = convertMetres(response.Distances[0][i+1], false) // +1 to skip the start location
 		}
 	}
-	return parksData[:count], nil
+	return nil
 }
 
 // Haversine formula for calculating distances between two coordinates
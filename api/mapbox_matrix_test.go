@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// matrixServer answers Matrix requests with a drive of lon hours and lon km to a park at
+// longitude lon, and fails the requests with a park at failLon
+func matrixServer(t *testing.T, failLon float64) *atomic.Int32 {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		coordinates := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), ";")
+		durations, distances := []float64{0}, []float64{0}
+		for _, coordinate := range coordinates[1:] {
+			lon, _ := strconv.ParseFloat(strings.Split(coordinate, ",")[0], 64)
+			if lon == failLon {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			durations = append(durations, lon*3600)
+			distances = append(distances, lon*1000)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"durations": [][]float64{durations}, "distances": [][]float64{distances}})
+	}))
+	t.Cleanup(server.Close)
+	previous := matrixURL
+	matrixURL = server.URL + "/"
+	t.Cleanup(func() { matrixURL = previous })
+	return &requests
+}
+
+func TestFetchDrivingDistances(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int
+		failLon  float64
+		parks    int
+		requests int32
+		unknown  int
+	}{
+		{"one batch", 8, -1, 8, 1, 0},
+		{"two batches", 30, -1, 30, 2, 0},
+		{"failed batch", 30, 30, 30, 2, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := matrixServer(t, test.failLon)
+			client := NewClient(map[string]HostPolicy{"": {}})
+			client.MaxRetries = 0
+			// parks at longitudes 30 to 1, the closest is the last one
+			var parks []Park
+			for lon := 30; lon >= 1; lon-- {
+				parks = append(parks, Park{ParkCode: fmt.Sprint(lon), Latitude: "0", Longitude: fmt.Sprint(lon)})
+			}
+
+			result, err := FetchDrivingDistances(context.Background(), client, [2]float64{0, 0}, parks, test.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result) != test.parks || requests.Load() != test.requests {
+				t.Fatalf("%d parks in %d requests, want %d in %d", len(result), requests.Load(), test.parks, test.requests)
+			}
+			unknown := 0
+			for i, park := range result {
+				// the parks are sorted by distance, each with its own drive
+				if park.ParkCode != fmt.Sprint(i+1) {
+					t.Fatalf("park %d is %s, want %d", i, park.ParkCode, i+1)
+				}
+				if !park.HasDrive() {
+					unknown++
+					continue
+				}
+				if want := fmt.Sprintf("%d.0", i+1); park.DriveTime != want || park.DrivingDistanceKm != want {
+					t.Errorf("park %s: drive %s hr, %s km, want %s", park.ParkCode, park.DriveTime, park.DrivingDistanceKm, want)
+				}
+			}
+			if unknown != test.unknown {
+				t.Errorf("%d parks with an unknown drive, want %d", unknown, test.unknown)
+			}
+		})
+	}
+}
+
+func TestFetchDrivingDistancesFails(t *testing.T) {
+	matrixServer(t, 1)
+	client := NewClient(map[string]HostPolicy{"": {}})
+	client.MaxRetries = 0
+	parks := []Park{{Latitude: "0", Longitude: "1"}, {Latitude: "0", Longitude: "2"}}
+	if _, err := FetchDrivingDistances(context.Background(), client, [2]float64{0, 0}, parks, 8); err == nil {
+		t.Error("FetchDrivingDistances() succeeded without any drive")
+	}
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	npsBaseURL         = "https://developer.nps.gov/api/v1"
+	npsDefaultPageSize = 50
+)
+
+// NPSProvider reads parks, campgrounds and alerts from the National Park Service API.
+// Every endpoint is walked page by page, so PageSize only controls the size of each request.
+type NPSProvider struct {
+	APIKey   string
+	BaseURL  string
+	PageSize int
+	Client   *Client
+}
+
+func NewNPSProvider(client *Client, apiKey string) *NPSProvider {
+	return &NPSProvider{
+		Client:   client,
+		APIKey:   apiKey,
+		BaseURL:  npsBaseURL,
+		PageSize: npsDefaultPageSize,
+	}
+}
+
+// npsCount decodes the paging fields of the NPS API, which are sent as quoted numbers
+type npsCount int
+
+func (c *npsCount) UnmarshalJSON(b []byte) error {
+	n, err := strconv.Atoi(string(bytes.Trim(b, `"`)))
+	if err != nil {
+		return fmt.Errorf("invalid NPS paging value %s: %w", b, err)
+	}
+	*c = npsCount(n)
+	return nil
+}
+
+// JSON shapes of the NPS API responses
+type npsImage struct {
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	AltText string `json:"altText"`
+	Caption string `json:"caption"`
+	Credit  string `json:"credit"`
+}
+
+type npsPark struct {
+	FullName       string     `json:"fullName"`
+	Description    string     `json:"description"`
+	Latitude       string     `json:"latitude"`
+	Longitude      string     `json:"longitude"`
+	States         string     `json:"states"`
+	Designation    string     `json:"designation"`
+	ParkCode       string     `json:"parkCode"`
+	DirectionsInfo string     `json:"directionsInfo"`
+	WeatherInfo    string     `json:"weatherInfo"`
+	Images         []npsImage `json:"images"`
+}
+
+type npsCampground struct {
+	Id                  string     `json:"id"`
+	Name                string     `json:"name"`
+	ParkCode            string     `json:"parkCode"`
+	Description         string     `json:"description"`
+	Latitude            string     `json:"latitude"`
+	Longitude           string     `json:"longitude"`
+	ReservationInfo     string     `json:"reservationInfo"`
+	ReservationURL      string     `json:"reservationUrl"`
+	DirectionsOverview  string     `json:"directionsOverview"`
+	WeatherOverview     string     `json:"weatherOverview"`
+	Reservable          string     `json:"numberOfSitesReservable"`
+	FirstComeFirstServe string     `json:"numberOfSitesFirstComeFirstServe"`
+	Images              []npsImage `json:"images"`
+}
+
+type npsAlert struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	URL         string `json:"url"`
+}
+
+func (p *NPSProvider) Name() string {
+	return "nps"
+}
+
+func (p *NPSProvider) ListParks(ctx context.Context) ([]ProviderPark, error) {
+	data, err := npsGet[npsPark](ctx, p, "parks", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	parks := make([]ProviderPark, 0, len(data))
+	for _, park := range data {
+		parks = append(parks, ProviderPark{
+			Code:           park.ParkCode,
+			Name:           park.FullName,
+			Designation:    park.Designation,
+			Description:    park.Description,
+			Latitude:       park.Latitude,
+			Longitude:      park.Longitude,
+			States:         park.States,
+			WeatherInfo:    park.WeatherInfo,
+			DirectionsInfo: park.DirectionsInfo,
+			Images:         npsImages(park.Images),
+		})
+	}
+	return parks, nil
+}
+
+func (p *NPSProvider) ListCampgrounds(ctx context.Context, parkCode string) ([]ProviderCampground, error) {
+	data, err := npsGet[npsCampground](ctx, p, "campgrounds", url.Values{"parkCode": {parkCode}})
+	if err != nil {
+		return nil, err
+	}
+	campgrounds := make([]ProviderCampground, 0, len(data))
+	for _, campground := range data {
+		reservable, _ := strconv.Atoi(campground.Reservable)
+		firstComeFirstServe, _ := strconv.Atoi(campground.FirstComeFirstServe)
+		campgrounds = append(campgrounds, ProviderCampground{
+			Id:                  campground.Id,
+			Name:                campground.Name,
+			ParkCode:            campground.ParkCode,
+			Description:         campground.Description,
+			Latitude:            campground.Latitude,
+			Longitude:           campground.Longitude,
+			ReservationInfo:     campground.ReservationInfo,
+			ReservationURL:      campground.ReservationURL,
+			DirectionsOverview:  campground.DirectionsOverview,
+			WeatherOverview:     campground.WeatherOverview,
+			Reservable:          reservable,
+			FirstComeFirstServe: firstComeFirstServe,
+			Images:              npsImages(campground.Images),
+		})
+	}
+	return campgrounds, nil
+}
+
+func (p *NPSProvider) ListAlerts(ctx context.Context, parkCode string) ([]ProviderAlert, error) {
+	data, err := npsGet[npsAlert](ctx, p, "alerts", url.Values{"parkCode": {parkCode}})
+	if err != nil {
+		return nil, err
+	}
+	alerts := make([]ProviderAlert, 0, len(data))
+	for _, alert := range data {
+		alerts = append(alerts, ProviderAlert{
+			Title:       alert.Title,
+			Description: alert.Description,
+			Category:    alert.Category,
+			URL:         alert.URL,
+		})
+	}
+	return alerts, nil
+}
+
+// npsGet walks every page of an NPS API endpoint and returns the "data" arrays of all pages.
+// The last page is the first one with fewer records than the page size, the total reported
+// by the API is missing from some responses and is not relied on.
+func npsGet[T any](ctx context.Context, p *NPSProvider, endpoint string, params url.Values) ([]T, error) {
+	pageSize := p.PageSize
+	if pageSize <= 0 {
+		pageSize = npsDefaultPageSize
+	}
+	params.Set("api_key", p.APIKey)
+	params.Set("limit", strconv.Itoa(pageSize))
+	var all []T
+	pages := 0
+	for {
+		params.Set("start", strconv.Itoa(len(all)))
+		page, err := npsGetPage[T](ctx, p.Client, p.BaseURL+"/"+endpoint+"?"+params.Encode(), endpoint, len(all))
+		if err != nil {
+			return nil, err
+		}
+		pages++
+		all = append(all, page...)
+		if len(page) < pageSize {
+			break
+		}
+	}
+	RecordFetch(ctx, endpoint, pages, len(all))
+	log.Printf("Fetched %d NPS %s records in %d pages", len(all), endpoint, pages)
+	return all, nil
+}
+
+// npsGetPage fetches a single page and returns its records
+func npsGetPage[T any](ctx context.Context, client *Client, pageURL string, endpoint string, start int) ([]T, error) {
+	resp, err := client.Get(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch NPS %s: %s", endpoint, resp.Status)
+	}
+	var data struct {
+		Start npsCount `json:"start"`
+		Data  []T      `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	if int(data.Start) != start {
+		return nil, fmt.Errorf("NPS %s returned page starting at %d, expected %d", endpoint, data.Start, start)
+	}
+	return data.Data, nil
+}
+
+func npsImages(images []npsImage) []ProviderImage {
+	result := make([]ProviderImage, 0, len(images))
+	for _, image := range images {
+		result = append(result, ProviderImage{
+			URL:     image.URL,
+			Title:   image.Title,
+			AltText: image.AltText,
+			Caption: image.Caption,
+			Credit:  image.Credit,
+		})
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// npsServer serves parks codes p0, p1, ... page by page, like the NPS parks endpoint
+func npsServer(t *testing.T, parks int, withTotal bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		data := []npsPark{}
+		for i := start; i < min(start+limit, parks); i++ {
+			data = append(data, npsPark{ParkCode: fmt.Sprintf("p%d", i)})
+		}
+		page := map[string]any{"start": strconv.Itoa(start), "data": data}
+		if withTotal {
+			page["total"] = strconv.Itoa(parks)
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNPSListParksPages(t *testing.T) {
+	tests := []struct {
+		name      string
+		parks     int
+		withTotal bool
+		pages     int
+	}{
+		{"last page is short", 5, true, 3},
+		{"last page is empty", 4, true, 3},
+		{"no total", 5, false, 3},
+		{"no parks", 0, false, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := NewNPSProvider(NewClient(map[string]HostPolicy{"": {}}), "key")
+			provider.BaseURL = npsServer(t, test.parks, test.withTotal).URL
+			provider.PageSize = 2
+
+			ctx, fetchLog := WithFetchLog(context.Background())
+			parks, err := provider.ListParks(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var codes, want []string
+			for i, park := range parks {
+				codes = append(codes, park.Code)
+				want = append(want, fmt.Sprintf("p%d", i))
+			}
+			if len(parks) != test.parks || !slices.Equal(codes, want) {
+				t.Errorf("ListParks() = %v, want %d parks in order", codes, test.parks)
+			}
+			if summary := fetchLog.Summary(); len(summary) != 1 || summary[0].Pages != test.pages {
+				t.Errorf("Summary() = %+v, want %d pages", summary, test.pages)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const nwsBaseURL = "https://api.weather.gov"
+
+// NWSWeather reads forecasts from the National Weather Service API. It is free and
+// needs no key, but only covers the US and requires a User-Agent identifying the app.
+type NWSWeather struct {
+	UserAgent string
+	BaseURL   string
+	Client    *Client
+
+	mu sync.Mutex
+	// gridpoint forecast urls by location, they don't change
+	gridpoints map[string]nwsGridpoint
+}
+
+type nwsGridpoint struct {
+	Forecast       string `json:"forecast"`
+	ForecastHourly string `json:"forecastHourly"`
+}
+
+type nwsForecast struct {
+	Properties struct {
+		UpdateTime time.Time   `json:"updateTime"`
+		Periods    []nwsPeriod `json:"periods"`
+	} `json:"properties"`
+}
+
+func NewNWSWeather(client *Client, userAgent string) *NWSWeather {
+	return &NWSWeather{
+		UserAgent:  userAgent,
+		BaseURL:    nwsBaseURL,
+		Client:     client,
+		gridpoints: map[string]nwsGridpoint{},
+	}
+}
+
+func (w *NWSWeather) Name() string {
+	return "nws"
+}
+
+type nwsPeriod struct {
+	StartTime       time.Time `json:"startTime"`
+	IsDaytime       bool      `json:"isDaytime"`
+	Temperature     float64   `json:"temperature"`
+	TemperatureUnit string    `json:"temperatureUnit"`
+	Icon            string    `json:"icon"`
+	ShortForecast   string    `json:"shortForecast"`
+	// e.g. "10 mph" or "5 to 15 mph"
+	WindSpeed                  string      `json:"windSpeed"`
+	WindDirection              string      `json:"windDirection"`
+	ProbabilityOfPrecipitation nwsQuantity `json:"probabilityOfPrecipitation"`
+	RelativeHumidity           nwsQuantity `json:"relativeHumidity"`
+}
+
+// nwsQuantity is a value of the forecast, which is null when unknown
+type nwsQuantity struct {
+	Value *float64 `json:"value"`
+}
+
+func (q nwsQuantity) String() string {
+	if q.Value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.0f", *q.Value)
+}
+
+// windMph returns the highest wind speed of a period in mph
+func (p nwsPeriod) windMph() float64 {
+	var mph float64
+	for _, field := range strings.Fields(p.WindSpeed) {
+		if speed, err := strconv.ParseFloat(field, 64); err == nil {
+			mph = max(mph, speed)
+		}
+	}
+	return mph
+}
+
+func (p nwsPeriod) temperatures() (f string, c string) {
+	if p.TemperatureUnit == "C" {
+		return celsiusToFahrenheit(p.Temperature), fmt.Sprintf("%.1f", p.Temperature)
+	}
+	return fmt.Sprintf("%.1f", p.Temperature), fahrenheitToCelsius(p.Temperature)
+}
+
+func (w *NWSWeather) Forecast(ctx context.Context, lat, lon string) (*Forecast, error) {
+	gridpoint, err := w.gridpoint(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	var daily nwsForecast
+	if err := w.get(ctx, gridpoint.Forecast, &daily); err != nil {
+		return nil, err
+	}
+	forecast := &Forecast{
+		Provider: w.Name(),
+		IssuedAt: daily.Properties.UpdateTime,
+		Daily:    w.daily(daily.Properties.Periods),
+	}
+	if len(daily.Properties.Periods) > 0 {
+		_, forecast.UTCOffset = daily.Properties.Periods[0].StartTime.Zone()
+	}
+	// the hourly forecast and the alerts are separate requests, the daily forecast is kept if they fail
+	alerts, err := w.alerts(ctx, lat, lon)
+	if err != nil {
+		log.Printf("Failed to fetch NWS alerts at %s,%s: %v", lat, lon, err)
+	}
+	forecast.Alerts = alerts
+	var hourly nwsForecast
+	if err := w.get(ctx, gridpoint.ForecastHourly, &hourly); err != nil {
+		log.Printf("Failed to fetch NWS hourly forecast at %s,%s: %v", lat, lon, err)
+		return forecast, nil
+	}
+	for _, period := range hourly.Properties.Periods {
+		if len(forecast.Hourly) == 48 {
+			break
+		}
+		temperature := period.Temperature
+		if period.TemperatureUnit != "C" {
+			temperature = (temperature - 32) / 1.8
+		}
+		var pop float64
+		if period.ProbabilityOfPrecipitation.Value != nil {
+			pop = *period.ProbabilityOfPrecipitation.Value
+		}
+		forecast.Hourly = append(forecast.Hourly, WeatherHour{
+			Time:              period.StartTime.Unix(),
+			TemperatureC:      math.Round(temperature*10) / 10,
+			PrecipProbability: pop,
+			WindKmh:           math.Round(period.windMph() * 1.609344),
+		})
+	}
+	return forecast, nil
+}
+
+// daily merges the day and night periods of the daily forecast
+func (w *NWSWeather) daily(periods []nwsPeriod) []WeatherDate {
+	// the forecast has a day and a night period per date, in the time zone of the park
+	var weatherDates []WeatherDate
+	byDay := map[string]int{}
+	for _, period := range periods {
+		day := period.StartTime.Format(time.DateOnly)
+		i, ok := byDay[day]
+		if !ok {
+			// the forecast starts with tonight late in the day, without a day temperature
+			if !period.IsDaytime {
+				continue
+			}
+			i = len(weatherDates)
+			byDay[day] = i
+			weatherDates = append(weatherDates, WeatherDate{
+				Date:      period.StartTime.Format("Jan 2"),
+				Day:       day,
+				MoonPhase: moonPhaseName(moonPhase(period.StartTime)),
+				Provider:  w.Name(),
+			})
+		}
+		f, c := period.temperatures()
+		if period.IsDaytime {
+			weatherDates[i].TemperatureDayF, weatherDates[i].TemperatureDayC = f, c
+			weatherDates[i].WeatherIcon = period.Icon
+			weatherDates[i].Summary = period.ShortForecast
+			weatherDates[i].PrecipProbability = period.ProbabilityOfPrecipitation.String()
+			weatherDates[i].Humidity = period.RelativeHumidity.String()
+			weatherDates[i].WindDirection = period.WindDirection
+			if mph := period.windMph(); mph > 0 {
+				weatherDates[i].WindMph = fmt.Sprintf("%.0f", mph)
+				weatherDates[i].WindKmh = fmt.Sprintf("%.0f", mph*1.609344)
+			}
+		} else {
+			weatherDates[i].TemperatureNightF, weatherDates[i].TemperatureNightC = f, c
+		}
+	}
+	return weatherDates
+}
+
+// alerts returns the active alerts at a location
+func (w *NWSWeather) alerts(ctx context.Context, lat, lon string) ([]WeatherAlert, error) {
+	point, err := nwsPoint(lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	var active struct {
+		Features []struct {
+			Properties struct {
+				Event       string    `json:"event"`
+				Headline    string    `json:"headline"`
+				Description string    `json:"description"`
+				Instruction string    `json:"instruction"`
+				Severity    string    `json:"severity"`
+				Effective   time.Time `json:"effective"`
+				Expires     time.Time `json:"expires"`
+				Ends        time.Time `json:"ends"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := w.get(ctx, w.BaseURL+"/alerts/active?point="+point, &active); err != nil {
+		return nil, err
+	}
+	alerts := make([]WeatherAlert, 0, len(active.Features))
+	for _, feature := range active.Features {
+		properties := feature.Properties
+		description := properties.Description
+		if properties.Instruction != "" {
+			description += "\n\n" + properties.Instruction
+		}
+		// expires is when the alert is updated, ends when the event is over
+		expires := properties.Ends
+		if expires.IsZero() {
+			expires = properties.Expires
+		}
+		alerts = append(alerts, WeatherAlert{
+			Event:       properties.Event,
+			Headline:    properties.Headline,
+			Description: description,
+			Severity:    normalizeSeverity(properties.Severity),
+			Effective:   properties.Effective,
+			Expires:     expires,
+		})
+	}
+	return alerts, nil
+}
+
+// gridpoint looks up the gridpoint forecasts of a location
+func (w *NWSWeather) gridpoint(ctx context.Context, lat, lon string) (nwsGridpoint, error) {
+	point, err := nwsPoint(lat, lon)
+	if err != nil {
+		return nwsGridpoint{}, err
+	}
+	w.mu.Lock()
+	gridpoint, ok := w.gridpoints[point]
+	w.mu.Unlock()
+	if ok {
+		return gridpoint, nil
+	}
+	var points struct {
+		Properties nwsGridpoint `json:"properties"`
+	}
+	if err := w.get(ctx, w.BaseURL+"/points/"+point, &points); err != nil {
+		return nwsGridpoint{}, err
+	}
+	if points.Properties.Forecast == "" {
+		return nwsGridpoint{}, fmt.Errorf("no NWS forecast at %s", point)
+	}
+	w.mu.Lock()
+	w.gridpoints[point] = points.Properties
+	w.mu.Unlock()
+	return points.Properties, nil
+}
+
+// nwsPoint formats a location as the API expects it, with at most 4 decimals
+func nwsPoint(lat, lon string) (string, error) {
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid latitude %q", lat)
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid longitude %q", lon)
+	}
+	return strconv.FormatFloat(latitude, 'f', 4, 64) + "," + strconv.FormatFloat(longitude, 'f', 4, 64), nil
+}
+
+func (w *NWSWeather) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", w.UserAgent)
+	req.Header.Set("Accept", "application/geo+json")
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// locations outside of the US are answered with 404
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch NWS %s: %s", req.URL.Path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const owmAirPollutionURL = "https://api.openweathermap.org/data/2.5/air_pollution/forecast"
+
+// OWMAirQuality reads air quality from the OpenWeatherMap Air Pollution API. It covers the
+// whole world with modelled concentrations, which are converted to the US AQI.
+type OWMAirQuality struct {
+	APIKey  string
+	BaseURL string
+	Client  *Client
+}
+
+func NewOWMAirQuality(client *Client, apiKey string) *OWMAirQuality {
+	return &OWMAirQuality{
+		APIKey:  apiKey,
+		BaseURL: owmAirPollutionURL,
+		Client:  client,
+	}
+}
+
+func (a *OWMAirQuality) Name() string {
+	return "owm"
+}
+
+// AirQuality reads the hourly forecast of the next 4 days, its first hour is the current one
+func (a *OWMAirQuality) AirQuality(ctx context.Context, lat, lon string) (*AirQuality, error) {
+	params := url.Values{}
+	params.Add("lat", lat)
+	params.Add("lon", lon)
+	params.Add("appid", a.APIKey)
+	resp, err := a.Client.Get(ctx, a.BaseURL+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OpenWeatherMap air pollution: %s", resp.Status)
+	}
+	var result struct {
+		List []struct {
+			Dt         int64 `json:"dt"`
+			Components struct {
+				PM25 float64 `json:"pm2_5"`
+				PM10 float64 `json:"pm10"`
+			} `json:"components"`
+		} `json:"list"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.List) == 0 {
+		return nil, fmt.Errorf("no air pollution data at %s,%s", lat, lon)
+	}
+	// the API has no time zone, the days are those of the solar time of the park
+	longitude, _ := strconv.ParseFloat(lon, 64)
+	location := time.FixedZone("", int(math.Round(longitude/15))*3600)
+
+	airQuality := &AirQuality{Provider: a.Name(), UpdatedAt: time.Now()}
+	days := map[string]int{}
+	var order []string
+	for i, hour := range result.List {
+		// hourly concentrations, the AQI is an approximation of the 24 hour one
+		aqi, pollutant := usAQI(hour.Components.PM25, pm25Breakpoints), "PM2.5"
+		if pm10 := usAQI(hour.Components.PM10, pm10Breakpoints); pm10 > aqi {
+			aqi, pollutant = pm10, "PM10"
+		}
+		if i == 0 {
+			airQuality.AQI, airQuality.Pollutant = aqi, pollutant
+		}
+		day := time.Unix(hour.Dt, 0).In(location).Format(time.DateOnly)
+		if _, ok := days[day]; !ok {
+			order = append(order, day)
+		}
+		days[day] = max(days[day], aqi)
+	}
+	for _, day := range order {
+		airQuality.Forecast = append(airQuality.Forecast, AQIDay{Day: day, AQI: days[day]})
+	}
+	return airQuality, nil
+}
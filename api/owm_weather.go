@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const owmOneCallURL = "https://api.openweathermap.org/data/3.0/onecall"
+
+// OWMWeather reads forecasts from the OpenWeatherMap One Call 3.0 API, which covers
+// the whole world but needs a paid subscription beyond its free calls
+type OWMWeather struct {
+	APIKey  string
+	BaseURL string
+	Client  *Client
+}
+
+func NewOWMWeather(client *Client, apiKey string) *OWMWeather {
+	return &OWMWeather{
+		APIKey:  apiKey,
+		BaseURL: owmOneCallURL,
+		Client:  client,
+	}
+}
+
+func (w *OWMWeather) Name() string {
+	return "owm"
+}
+
+func (w *OWMWeather) Forecast(ctx context.Context, lat, lon string) (*Forecast, error) {
+	params := url.Values{}
+	params.Add("lat", lat)
+	params.Add("lon", lon)
+	params.Add("exclude", "minutely")
+	params.Add("appid", w.APIKey)
+	resp, err := w.Client.Get(ctx, w.BaseURL+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OpenWeatherMap forecast: %s", resp.Status)
+	}
+	var result struct {
+		Timezone       string `json:"timezone"`
+		TimezoneOffset int    `json:"timezone_offset"`
+		Current        struct {
+			Dt int64 `json:"dt"`
+		} `json:"current"`
+		Hourly []struct {
+			Dt        int64   `json:"dt"`
+			Temp      float64 `json:"temp"`
+			Pop       float64 `json:"pop"`
+			WindSpeed float64 `json:"wind_speed"`
+		} `json:"hourly"`
+		Alerts []struct {
+			SenderName  string `json:"sender_name"`
+			Event       string `json:"event"`
+			Start       int64  `json:"start"`
+			End         int64  `json:"end"`
+			Description string `json:"description"`
+		} `json:"alerts"`
+		Daily []struct {
+			Dt        int64   `json:"dt"`
+			Sunrise   int64   `json:"sunrise"`
+			Sunset    int64   `json:"sunset"`
+			MoonPhase float64 `json:"moon_phase"`
+			Temp      struct {
+				Day   float64 `json:"day"`
+				Night float64 `json:"night"`
+			} `json:"temp"`
+			Humidity  float64 `json:"humidity"`
+			WindSpeed float64 `json:"wind_speed"`
+			WindGust  float64 `json:"wind_gust"`
+			WindDeg   float64 `json:"wind_deg"`
+			Pop       float64 `json:"pop"`
+			Rain      float64 `json:"rain"`
+			Snow      float64 `json:"snow"`
+			UVI       float64 `json:"uvi"`
+			Weather   []struct {
+				Icon        string `json:"icon"`
+				Description string `json:"description"`
+			} `json:"weather"`
+		} `json:"daily"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	// the days are those of the park, not of the server
+	location, err := time.LoadLocation(result.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	var weatherDates []WeatherDate
+	for _, daily := range result.Daily {
+		date := time.Unix(daily.Dt, 0).In(location)
+		weatherDate := WeatherDate{
+			Date:              date.Format("Jan 2"),
+			Day:               date.Format(time.DateOnly),
+			TemperatureDayF:   kelvinToFahrenheit(daily.Temp.Day),
+			TemperatureDayC:   kelvinToCelsius(daily.Temp.Day),
+			TemperatureNightF: kelvinToFahrenheit(daily.Temp.Night),
+			TemperatureNightC: kelvinToCelsius(daily.Temp.Night),
+			PrecipProbability: fmt.Sprintf("%.0f", daily.Pop*100),
+			WindDirection:     compassDirection(daily.WindDeg),
+			Humidity:          fmt.Sprintf("%.0f", daily.Humidity),
+			UVIndex:           fmt.Sprintf("%.1f", daily.UVI),
+			Sunrise:           time.Unix(daily.Sunrise, 0).In(location).Format("15:04"),
+			Sunset:            time.Unix(daily.Sunset, 0).In(location).Format("15:04"),
+			MoonPhase:         moonPhaseName(daily.MoonPhase),
+			Provider:          w.Name(),
+		}
+		// the speeds are in m/s and the amounts in mm
+		weatherDate.RainMm, weatherDate.RainIn = precipitation(daily.Rain)
+		weatherDate.SnowMm, weatherDate.SnowIn = precipitation(daily.Snow)
+		weatherDate.WindMph, weatherDate.WindKmh = windSpeed(daily.WindSpeed)
+		weatherDate.GustMph, weatherDate.GustKmh = windSpeed(daily.WindGust)
+		if len(daily.Weather) > 0 {
+			weatherDate.WeatherIcon = fmt.Sprintf("https://openweathermap.org/img/wn/%s@2x.png", daily.Weather[0].Icon)
+			weatherDate.Summary = daily.Weather[0].Description
+		}
+		weatherDates = append(weatherDates, weatherDate)
+	}
+	forecast := &Forecast{
+		Provider:  w.Name(),
+		UTCOffset: result.TimezoneOffset,
+		Daily:     weatherDates,
+	}
+	// the forecast is as recent as its current conditions, without them the issue time
+	// is left zero and the time of the fetch is used instead
+	if result.Current.Dt != 0 {
+		forecast.IssuedAt = time.Unix(result.Current.Dt, 0)
+	}
+	for _, hourly := range result.Hourly {
+		forecast.Hourly = append(forecast.Hourly, WeatherHour{
+			Time:              hourly.Dt,
+			TemperatureC:      math.Round((hourly.Temp-273.15)*10) / 10,
+			PrecipProbability: math.Round(hourly.Pop * 100),
+			WindKmh:           math.Round(hourly.WindSpeed * 3.6),
+		})
+	}
+	// the alerts have no severity, it is guessed from their name
+	forecast.Alerts = []WeatherAlert{}
+	for _, alert := range result.Alerts {
+		forecast.Alerts = append(forecast.Alerts, WeatherAlert{
+			Event:       alert.Event,
+			Headline:    alert.Event + " issued by " + alert.SenderName,
+			Description: alert.Description,
+			Severity:    severityOfEvent(alert.Event),
+			Effective:   time.Unix(alert.Start, 0),
+			Expires:     time.Unix(alert.End, 0),
+		})
+	}
+	return forecast, nil
+}
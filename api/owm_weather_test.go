@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOWMForecastIssuedAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		want    time.Time
+	}{
+		{"current conditions", `{"dt": 1783778400}`, time.Unix(1783778400, 0)},
+		{"no current conditions", `{}`, time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"timezone": "America/Los_Angeles", "timezone_offset": -25200, "current": ` + test.current +
+					`, "daily": [{"dt": 1783800000, "temp": {"day": 293.15, "night": 283.15}}]}`))
+			}))
+			defer server.Close()
+			provider := NewOWMWeather(NewClient(map[string]HostPolicy{"": {}}), "key")
+			provider.BaseURL = server.URL
+
+			forecast, err := provider.Forecast(context.Background(), "37.8", "-119.5")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !forecast.IssuedAt.Equal(test.want) || forecast.IssuedAt.IsZero() != test.want.IsZero() {
+				t.Errorf("IssuedAt = %v, want %v", forecast.IssuedAt, test.want)
+			}
+			// the day of the forecast is the day at the park, 13:00 PDT
+			if len(forecast.Daily) != 1 || forecast.Daily[0].Day != "2026-07-11" || forecast.UTCOffset != -25200 {
+				t.Errorf("forecast = %+v, want the day 2026-07-11 at offset -25200", forecast)
+			}
+		})
+	}
+}
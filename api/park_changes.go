@@ -0,0 +1,168 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// contentHash returns the hash of a provider payload, records whose payload hash didn't
+// change since the last run are not saved again
+func contentHash(payload any) string {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeImages trims the texts of provider images, which are sent with stray whitespace
+func normalizeImages(images []ProviderImage) []ProviderImage {
+	normalized := make([]ProviderImage, 0, len(images))
+	for _, image := range images {
+		normalized = append(normalized, ProviderImage{
+			URL:     strings.TrimSpace(image.URL),
+			Title:   strings.TrimSpace(image.Title),
+			AltText: strings.TrimSpace(image.AltText),
+			Caption: strings.TrimSpace(image.Caption),
+			Credit:  strings.TrimSpace(image.Credit),
+		})
+	}
+	return normalized
+}
+
+func normalizePark(park ProviderPark) ProviderPark {
+	return ProviderPark{
+		Code:           strings.TrimSpace(park.Code),
+		Name:           strings.TrimSpace(park.Name),
+		Designation:    strings.TrimSpace(park.Designation),
+		Description:    strings.TrimSpace(park.Description),
+		Latitude:       strings.TrimSpace(park.Latitude),
+		Longitude:      strings.TrimSpace(park.Longitude),
+		States:         strings.TrimSpace(park.States),
+		WeatherInfo:    strings.TrimSpace(park.WeatherInfo),
+		DirectionsInfo: strings.TrimSpace(park.DirectionsInfo),
+		Images:         normalizeImages(park.Images),
+	}
+}
+
+func normalizeCampground(campground ProviderCampground) ProviderCampground {
+	return ProviderCampground{
+		Id:                  strings.TrimSpace(campground.Id),
+		Name:                strings.TrimSpace(campground.Name),
+		ParkCode:            strings.TrimSpace(campground.ParkCode),
+		Description:         strings.TrimSpace(campground.Description),
+		Latitude:            strings.TrimSpace(campground.Latitude),
+		Longitude:           strings.TrimSpace(campground.Longitude),
+		ReservationInfo:     strings.TrimSpace(campground.ReservationInfo),
+		ReservationURL:      strings.TrimSpace(campground.ReservationURL),
+		DirectionsOverview:  strings.TrimSpace(campground.DirectionsOverview),
+		WeatherOverview:     strings.TrimSpace(campground.WeatherOverview),
+		Reservable:          campground.Reservable,
+		FirstComeFirstServe: campground.FirstComeFirstServe,
+		Images:              normalizeImages(campground.Images),
+	}
+}
+
+// imagesComplete reports whether every stored image of a record has complete metadata,
+// records with older metadata are saved again to process their images
+func imagesComplete(record *models.Record) bool {
+	meta := LoadImageMeta(record)
+	for _, file := range record.GetStringSlice("images") {
+		if m := FindImageMeta(meta, file); m == nil || !m.complete() {
+			return false
+		}
+	}
+	return true
+}
+
+// FieldChange is a changed field of a park or campground
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// diffRecord compares the data about to be saved in a record with its current values.
+// The images are compared by their provider urls.
+func diffRecord(record *models.Record, data map[string]any, images []ProviderImage) []FieldChange {
+	if record.IsNew() {
+		return []FieldChange{{Field: "record", New: "created"}}
+	}
+	var changes []FieldChange
+	fields := make([]string, 0, len(data))
+	for field := range data {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	for _, field := range fields {
+		old, new := record.GetString(field), fmt.Sprint(data[field])
+		if old != new {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+	var oldURLs, newURLs []string
+	meta := LoadImageMeta(record)
+	for _, m := range meta {
+		if m.Source != "" {
+			oldURLs = append(oldURLs, m.Source)
+		}
+	}
+	for _, image := range images {
+		if !slices.ContainsFunc(meta, func(m ImageMeta) bool { return m.hasSource(image.URL) }) {
+			newURLs = append(newURLs, image.URL)
+		}
+	}
+	if len(newURLs) > 0 {
+		changes = append(changes, FieldChange{Field: "images", Old: strings.Join(oldURLs, "\n"), New: strings.Join(newURLs, "\n")})
+	}
+	return changes
+}
+
+// saveChanges records the changed fields of a park or campground in the parkChanges
+// collection and in the summary of the run. The changes keep the park code, so they
+// stay readable once the park is pruned.
+func saveChanges(app *pocketbase.PocketBase, run *JobRun, kind string, record *models.Record, parkId string, item string, changes []FieldChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	run.Changed(item, fields)
+	collection, err := app.Dao().FindCollectionByNameOrId("parkChanges")
+	if err != nil {
+		log.Printf("Error recording changes of %s: %v", item, err)
+		return
+	}
+	parkCode := ""
+	if park, err := app.Dao().FindRecordById("parks", parkId); err == nil {
+		parkCode = park.GetString("parkCode")
+	}
+	now := types.NowDateTime()
+	for _, change := range changes {
+		entry := models.NewRecord(collection)
+		entry.Set("kind", kind)
+		entry.Set("recordId", record.Id)
+		entry.Set("park", parkId)
+		entry.Set("parkCode", parkCode)
+		entry.Set("field", change.Field)
+		entry.Set("oldValue", change.Old)
+		entry.Set("newValue", change.New)
+		entry.Set("changedAt", now)
+		entry.Set("jobRun", run.Id)
+		if err := app.Dao().SaveRecord(entry); err != nil {
+			log.Printf("Error recording change of %s %s: %v", item, change.Field, err)
+		}
+	}
+}
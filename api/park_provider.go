@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ParkProvider is a source of park data, e.g. the National Park Service API.
+// The ingestion loop only works with the provider-neutral types below, so a new
+// park system can be added by implementing this interface. Calls stop when ctx is done.
+type ParkProvider interface {
+	// Name identifies the provider in logs
+	Name() string
+	// ListParks returns every park known to the provider
+	ListParks(ctx context.Context) ([]ProviderPark, error)
+	// ListCampgrounds returns the campgrounds of a single park
+	ListCampgrounds(ctx context.Context, parkCode string) ([]ProviderCampground, error)
+	// ListAlerts returns the current alerts of a single park
+	ListAlerts(ctx context.Context, parkCode string) ([]ProviderAlert, error)
+}
+
+// FetchSummary counts the pages and records fetched from one provider endpoint.
+type FetchSummary struct {
+	Endpoint string
+	Pages    int
+	Records  int
+}
+
+func (s FetchSummary) String() string {
+	return fmt.Sprintf("%s: %d records in %d pages", s.Endpoint, s.Records, s.Pages)
+}
+
+// FetchLog counts what a run fetched from its provider, so the ingestion loop can log
+// a summary of each run. Providers record into the log of the context they are called
+// with, so concurrent runs sharing a provider are counted separately.
+type FetchLog struct {
+	mu      sync.Mutex
+	summary []FetchSummary
+}
+
+type fetchLogKey struct{}
+
+// WithFetchLog returns a context recording the fetches made with it into a new log
+func WithFetchLog(ctx context.Context) (context.Context, *FetchLog) {
+	fetchLog := &FetchLog{}
+	return context.WithValue(ctx, fetchLogKey{}, fetchLog), fetchLog
+}
+
+// RecordFetch adds fetched pages and records of an endpoint to the log of ctx, if any
+func RecordFetch(ctx context.Context, endpoint string, pages, records int) {
+	fetchLog, ok := ctx.Value(fetchLogKey{}).(*FetchLog)
+	if !ok {
+		return
+	}
+	fetchLog.mu.Lock()
+	defer fetchLog.mu.Unlock()
+	for i := range fetchLog.summary {
+		if fetchLog.summary[i].Endpoint == endpoint {
+			fetchLog.summary[i].Pages += pages
+			fetchLog.summary[i].Records += records
+			return
+		}
+	}
+	fetchLog.summary = append(fetchLog.summary, FetchSummary{Endpoint: endpoint, Pages: pages, Records: records})
+}
+
+// Summary returns the counts of each endpoint, in the order they were first fetched
+func (l *FetchLog) Summary() []FetchSummary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.summary)
+}
+
+// ProviderImage is a photo of a park or campground, with the text needed for
+// accessibility and photo credits
+type ProviderImage struct {
+	URL     string
+	Title   string
+	AltText string
+	Caption string
+	Credit  string
+}
+
+type ProviderPark struct {
+	Code           string
+	Name           string
+	Designation    string
+	Description    string
+	Latitude       string
+	Longitude      string
+	States         string
+	WeatherInfo    string
+	DirectionsInfo string
+	Images         []ProviderImage
+}
+
+type ProviderCampground struct {
+	Id                  string
+	Name                string
+	ParkCode            string
+	Description         string
+	Latitude            string
+	Longitude           string
+	ReservationInfo     string
+	ReservationURL      string
+	DirectionsOverview  string
+	WeatherOverview     string
+	Reservable          int
+	FirstComeFirstServe int
+	Images              []ProviderImage
+}
+
+type ProviderAlert struct {
+	Title       string
+	Description string
+	Category    string
+	URL         string
+}
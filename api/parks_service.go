@@ -2,221 +2,204 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"image"
-	"image/jpeg"
 	"image/png"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"path"
-	"strconv"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/daos"
 	"github.com/pocketbase/pocketbase/forms"
 	"github.com/pocketbase/pocketbase/models"
 	"github.com/pocketbase/pocketbase/tools/filesystem"
-	"github.com/pocketbase/pocketbase/tools/inflector"
-	"golang.org/x/image/draw"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"golang.org/x/sync/semaphore"
 )
 
 type Park struct {
-	FullName          string   `json:"fullName"`
-	Description       string   `json:"description"`
-	Latitude          string   `json:"latitude"`
-	Longitude         string   `json:"longitude"`
-	States            string   `json:"states"`
-	Images            []string `json:"-"` // "-" tells the json package to ignore this field when marshaling
-	Designation       string   `json:"designation"`
-	ParkCode          string   `json:"parkCode"`
-	DirectionsInfo    string   `json:"directionsInfo"`
-	WeatherInfo       string   `json:"weatherInfo"`
+	FullName          string
+	Description       string
+	Latitude          string
+	Longitude         string
+	States            string
+	Images            []string
+	ImageMeta         []ImageMeta
+	Designation       string
+	ParkCode          string
+	DirectionsInfo    string
+	WeatherInfo       string
 	DriveTime         string
 	DrivingDistanceMi string
 	DrivingDistanceKm string
 	HaversineDistance float64
 	ParkRecordId      string
 	Weather           []WeatherDate
-	Campgrounds       int
-	Alerts            []Alert
+	WeatherIssuedAt   time.Time
+	// offset of the local time at the park from UTC in seconds, from its forecast
+	UTCOffset   int
+	Campgrounds int
+	Alerts      []Alert
+	Climate     []ClimateMonth
+	// nil if unknown or too old
+	AirQuality *AirQuality
+	// set when the parks are sorted by weather
+	Score *WeatherScore
 }
 
-type WeatherDate struct {
-	Date              string `json:"date"`
-	TemperatureDayF   string `json:"temperatureDayF"`
-	TemperatureDayC   string `json:"temperatureDayC"`
-	TemperatureNightF string `json:"temperatureNightF"`
-	TemperatureNightC string `json:"temperatureNightC"`
-	WeatherIcon       string `json:"weatherIcon"`
-	LastUpdated       string `json:"lastUpdated"`
+// HasDrive reports whether the drive from the place to the park is known, it isn't when
+// the Matrix request of the park failed
+func (p Park) HasDrive() bool {
+	return p.DrivingDistanceMi != ""
 }
 
 type Campground struct {
-	Id                  string   `json:"id"`
-	Name                string   `json:"name"`
-	ParkCode            string   `json:"parkCode"`
-	Description         string   `json:"description"`
-	Latitude            string   `json:"latitude"`
-	Longitude           string   `json:"longitude"`
-	ReservationInfo     string   `json:"reservationInfo"`
-	ReservationURL      string   `json:"reservationUrl"`
-	DirectionsOverview  string   `json:"directionsOverview"`
-	Images              []string `json:"-"`
-	WeatherOverview     string   `json:"weatherOverview"`
-	Reservable          string   `json:"numberOfSitesReservable"`
-	FirstComeFirstServe string   `json:"numberOfSitesFirstComeFirstServe"`
-	MapImage            string   `json:"-"`
+	Id                  string
+	Name                string
+	ParkCode            string
+	Description         string
+	Latitude            string
+	Longitude           string
+	ReservationInfo     string
+	ReservationURL      string
+	DirectionsOverview  string
+	Images              []string
+	ImageMeta           []ImageMeta
+	WeatherOverview     string
+	Reservable          string
+	FirstComeFirstServe string
+	MapImage            string
 }
 
 type Alert struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Category    string `json:"severity"`
-	Url         string `json:"url"`
+	Title       string
+	Description string
+	Category    string
+	Url         string
+	// nps for park alerts, or the weather provider of a weather warning
+	Source    string
+	Severity  string
+	Effective time.Time
+	Expires   time.Time
 }
 
-var isRunning bool
-var mu sync.Mutex
-
-func FetchAndStoreNationalParks(app *pocketbase.PocketBase) error {
-	// prevent multiple fetches from running at the same time
-	mu.Lock()
-	defer mu.Unlock()
-
-	if isRunning {
-		log.Printf("National Parks data is already being fetched.")
-		return nil
-	}
-	isRunning = true
-	defer func() {
-		isRunning = false
-	}()
-	// fetch data from NPS API
-	NPS_API_KEY := os.Getenv("NPS_API_KEY")
-	var NPS_API_URL = "https://developer.nps.gov/api/v1/parks?limit=500&api_key=" + NPS_API_KEY
-	resp, err := http.Get(NPS_API_URL)
+// FetchAndStoreParks fetches parks from the given provider and stores the ones
+// with an allowed designation in Pocketbase, counting the stored records in run.
+// It stops after the current park when ctx is done.
+func FetchAndStoreParks(ctx context.Context, app *pocketbase.PocketBase, client *Client, images *ImagePool, provider ParkProvider, designations []string, run *JobRun) error {
+	ctx, fetchLog := WithFetchLog(ctx)
+	defer logFetchSummary(provider.Name(), fetchLog)
+	// fetch data from the park provider, a partial listing aborts the run
+	parks, err := provider.ListParks(ctx)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	// decode the JSON response
-	var data struct {
-		Data []struct {
-			Park
-			Images []struct {
-				URL string `json:"url"`
-			} `json:"images"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return err
-	}
 	// get the Pocketbase collection for National Parks
 	collection, err := app.Dao().FindCollectionByNameOrId("parks")
 	if err != nil {
 		return err
 	}
-	// filter for national parks only and store in Pocketbase
-	for _, park := range data.Data {
-		if park.Designation == "National Park" || park.Designation == "National Park & Preserve" {
-			var record *models.Record
-			existingRecord, err := app.Dao().FindFirstRecordByData("parks", "parkCode", park.ParkCode)
-			if err == nil {
-				record = existingRecord
-			} else {
-				record = models.NewRecord(collection)
-				record.Set("parkCode", park.ParkCode)
-			}
-			// load regular data into the form
-			form := forms.NewRecordUpsert(app, record)
-			form.LoadData(map[string]any{
-				"name":           park.FullName,
+	log.Printf("Storing parks designated %s", strings.Join(designations, ", "))
+	// parks missing from the listing or no longer allowed are retired once all parks are stored
+	fetched := make([]string, 0, len(parks))
+	// filter for allowed designations only and store in Pocketbase
+	for _, park := range parks {
+		if !slices.Contains(designations, park.Designation) {
+			continue
+		}
+		fetched = append(fetched, park.Code)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var record *models.Record
+		existingRecord, err := app.Dao().FindFirstRecordByData("parks", "parkCode", park.Code)
+		if err == nil {
+			record = existingRecord
+		} else {
+			record = models.NewRecord(collection)
+			record.Set("parkCode", park.Code)
+		}
+		item := "park " + park.Code
+		// the hash is only stored once all images are, so missing images are retried
+		hash := contentHash(normalizePark(park))
+		saveHash := false
+		if !record.IsNew() && !IsRetired(record) && record.GetString("contentHash") == hash && imagesComplete(record) {
+			// nothing changed since the last run, only the campgrounds are checked
+			run.Unchanged()
+		} else {
+			data := map[string]any{
+				"name":           park.Name,
+				"designation":    park.Designation,
 				"description":    park.Description,
 				"latitude":       park.Latitude,
 				"longitude":      park.Longitude,
 				"states":         park.States,
 				"weatherInfo":    park.WeatherInfo,
 				"directionsInfo": park.DirectionsInfo,
-			})
-			current_images := record.GetStringSlice("images")
-		ImageLoop:
-			for _, image := range park.Images {
-				imageURL := image.URL
-				// check if the image is already in the form
-				for _, existingImage := range current_images {
-					if inflector.Snakecase(quick_strip_url(imageURL)) == quick_strip(existingImage) {
-						continue ImageLoop
-					}
-				}
-				// resize the image using my helper function
-				resizedImageBytes, err := downloadAndResizeImage(imageURL, 1500)
-				if err != nil {
-					log.Printf("Error resizing image: %v", err)
-					continue
-				}
-				// save the image to a temporary file
-				tmpFile, err := filesystem.NewFileFromBytes(resizedImageBytes, path.Base(imageURL))
-				if err != nil {
-					log.Printf("Error saving image to a temporary file: %v", err)
-					continue
-				}
-				resizedImageBytes = nil // free up memory
-				log.Printf("Adding img to park %s: %f kb", park.ParkCode, float64(tmpFile.Size)/1024.0)
-				// add the image to the form
-				form.AddFiles("images", tmpFile)
-				tmpFile = nil // free up memory
-				if err := form.Submit(); err != nil {
-					log.Printf("Error saving record with image: %v", err)
-					continue
-				}
+				"retiredAt":      "",
 			}
-			log.Printf("Park %s has %d images", park.ParkCode, len(record.GetStringSlice("images")))
-			campCount, err := fetchCampgrounds(app, record.Id, park.ParkCode)
-			if err != nil {
-				log.Printf("Error fetching campgrounds: %v", err)
-				continue
+			changes := diffRecord(record, data, park.Images)
+			// load regular data into the form
+			form := forms.NewRecordUpsert(app, record)
+			form.LoadData(data)
+			// download and resize all new images at once, then save them in a single submit
+			saveHash = true
+			if err := addImages(ctx, app, images, form, record, item, park.Images); err != nil {
+				log.Printf("Error adding images to park %s: %v", park.Code, err)
+				run.Error(item, err)
+				saveHash = false
 			}
-			form.LoadData(map[string]any{
-				"campgrounds": campCount,
-			})
+			isNew := record.IsNew()
 			if err := form.Submit(); err != nil {
-				log.Printf("Error saving record with image: %v", err)
+				log.Printf("Error saving park %s: %v", park.Code, err)
+				run.Fail(item, err)
 				continue
 			}
+			run.Saved(isNew)
+			saveChanges(app, run, "park", record, record.Id, item, changes)
+			log.Printf("Park %s has %d images", park.Code, len(record.GetStringSlice("images")))
+		}
+		campCount, err := fetchCampgrounds(ctx, app, client, images, provider, record.Id, park.Code, run)
+		if err != nil {
+			log.Printf("Error fetching campgrounds: %v", err)
+			run.Fail("campgrounds of "+item, err)
+			continue
+		}
+		if !saveHash && record.GetInt("campgrounds") == campCount {
+			continue
+		}
+		// the images are already uploaded, so save the count and hash without the form
+		if saveHash {
+			record.Set("contentHash", hash)
+		}
+		record.Set("campgrounds", campCount)
+		if err := app.Dao().SaveRecord(record); err != nil {
+			log.Printf("Error saving park %s: %v", park.Code, err)
+			run.Fail(item, err)
+			continue
 		}
 	}
-	return nil
+	return retireMissing(app, run, "parks", "park", "parkCode", nil, fetched)
 }
 
-func fetchCampgrounds(app *pocketbase.PocketBase, parkId string, parkCode string) (count int, err error) {
-	// fetch data from NPS API
-	NPS_API_KEY := os.Getenv("NPS_API_KEY")
-	var NPS_API_URL = "https://developer.nps.gov/api/v1/campgrounds?parkCode=" + parkCode + "&api_key=" + NPS_API_KEY
-	resp, err := http.Get(NPS_API_URL)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return 0, err
-	}
-	// decode the JSON response and get image urls from the JSON
-	var data struct {
-		Data []struct {
-			Campground
-			Images []struct {
-				URL string `json:"url"`
-			} `json:"images"`
-		} `json:"data"`
+func logFetchSummary(name string, fetchLog *FetchLog) {
+	for _, summary := range fetchLog.Summary() {
+		log.Printf("Fetched from %s %s", name, summary)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+}
+
+func fetchCampgrounds(ctx context.Context, app *pocketbase.PocketBase, client *Client, images *ImagePool, provider ParkProvider, parkId string, parkCode string, run *JobRun) (count int, err error) {
+	// fetch campgrounds from the park provider
+	data, err := provider.ListCampgrounds(ctx, parkCode)
+	if err != nil {
 		return 0, err
 	}
 	campgrounds, err := app.Dao().FindCollectionByNameOrId("campgrounds")
@@ -224,7 +207,9 @@ func fetchCampgrounds(app *pocketbase.PocketBase, parkId string, parkCode string
 		return 0, err
 	}
 	// save the campgrounds to the national park record
-	for _, campground := range data.Data {
+	fetched := make([]string, 0, len(data))
+	for _, campground := range data {
+		fetched = append(fetched, campground.Id)
 		var record *models.Record
 		// Check if the campground already exists
 		existingCampground, err := app.Dao().FindFirstRecordByData("campgrounds", "campId", campground.Id)
@@ -234,10 +219,13 @@ func fetchCampgrounds(app *pocketbase.PocketBase, parkId string, parkCode string
 			log.Printf("Creating new record for campground %s", campground.Id)
 			record = models.NewRecord(campgrounds)
 		}
-		form := forms.NewRecordUpsert(app, record)
-		reservable, _ := strconv.Atoi(campground.Reservable)
-		firstComeFirstServe, _ := strconv.Atoi(campground.FirstComeFirstServe)
-		form.LoadData(map[string]any{
+		item := "campground " + campground.Id
+		hash := contentHash(normalizeCampground(campground))
+		if !record.IsNew() && !IsRetired(record) && record.GetString("contentHash") == hash && record.GetString("mapImage") != "" && imagesComplete(record) {
+			run.Unchanged()
+			continue
+		}
+		fields := map[string]any{
 			"name":                campground.Name,
 			"parkId":              parkId,
 			"description":         campground.Description,
@@ -247,70 +235,61 @@ func fetchCampgrounds(app *pocketbase.PocketBase, parkId string, parkCode string
 			"reservationUrl":      campground.ReservationURL,
 			"directionsOverview":  campground.DirectionsOverview,
 			"weatherOverview":     campground.WeatherOverview,
-			"reservable":          reservable,
-			"firstComeFirstServe": firstComeFirstServe,
+			"reservable":          campground.Reservable,
+			"firstComeFirstServe": campground.FirstComeFirstServe,
 			"campId":              campground.Id,
-		})
-		current_images := record.GetStringSlice("images")
-	ImageLoop:
-		// fetch images for each campground
-		for _, image := range campground.Images {
-			imageURL := image.URL
-			// check if the image is already in the form
-			for _, existingImage := range current_images {
-				if inflector.Snakecase(quick_strip_url(imageURL)) == quick_strip(existingImage) {
-					continue ImageLoop
-				}
-			}
-			// resize the image using my helper function
-			resizedImageBytes, err := downloadAndResizeImage(imageURL, 1500)
-			if err != nil {
-				log.Printf("Error resizing image: %v", err)
-				continue
-			}
-			// save the image to a temporary file
-			tmpFile, err := filesystem.NewFileFromBytes(resizedImageBytes, path.Base(imageURL))
-			if err != nil {
-				log.Printf("Error saving image to a temporary file: %v", err)
-				continue
-			}
-			resizedImageBytes = nil // free up memory
-			log.Printf("Resizing campground image: %f kb", float64(tmpFile.Size)/1024.0)
-			// add the image to the form
-			form.AddFiles("images", tmpFile)
-			tmpFile = nil // free up memory
-			if err := form.Submit(); err != nil {
-				log.Printf("Error saving record with image: %v", err)
-				continue
-			}
+			"retiredAt":           "",
+		}
+		changes := diffRecord(record, fields, campground.Images)
+		form := forms.NewRecordUpsert(app, record)
+		form.LoadData(fields)
+		// fetch images for each campground, the hash is only stored once all of them are
+		saveHash := true
+		if err := addImages(ctx, app, images, form, record, item, campground.Images); err != nil {
+			log.Printf("Error adding images to campground %s: %v", campground.Id, err)
+			run.Error(item, err)
+			saveHash = false
 		}
-		log.Printf("Camp %s has %d images", record.Id, len(record.GetStringSlice("images")))
 		if record.GetString("mapImage") == "" {
 			// get map image from mapbox
-			firstCome := campground.FirstComeFirstServe != "0"
-			imageBytes, err := getMapImage(campground.Latitude, campground.Longitude, firstCome)
+			firstCome := campground.FirstComeFirstServe != 0
+			imageBytes, err := getMapImage(ctx, client, campground.Latitude, campground.Longitude, firstCome)
 			if err != nil {
 				log.Printf("Error getting map image: %v", err)
-				continue
-			}
-			tmpfile, err := filesystem.NewFileFromBytes(imageBytes, "map.png")
-			if err != nil {
+				run.Error(item, err)
+				saveHash = false
+			} else if tmpfile, err := filesystem.NewFileFromBytes(imageBytes, "map.png"); err != nil {
 				log.Printf("Error saving map image to a temporary file: %v", err)
-				continue
+				saveHash = false
+			} else {
+				form.AddFiles("mapImage", tmpfile)
 			}
-			form.AddFiles("mapImage", tmpfile)
-			// save the campground record to the national park record
-			if err := form.Submit(); err != nil {
-				log.Printf("Error saving record with image: %v", err)
-				continue
+		}
+		// save the campground record with all new images at once
+		isNew := record.IsNew()
+		if err := form.Submit(); err != nil {
+			log.Printf("Error saving campground %s: %v", campground.Id, err)
+			run.Fail(item, err)
+			continue
+		}
+		run.Saved(isNew)
+		saveChanges(app, run, "campground", record, parkId, item, changes)
+		log.Printf("Camp %s has %d images", record.Id, len(record.GetStringSlice("images")))
+		if saveHash {
+			record.Set("contentHash", hash)
+			if err := app.Dao().SaveRecord(record); err != nil {
+				log.Printf("Error saving campground %s: %v", campground.Id, err)
 			}
-			imageBytes, tmpfile = nil, nil // free up memory
 		}
 	}
-	return len(data.Data), err
+	// campgrounds the park no longer lists are retired
+	if err := retireMissing(app, run, "campgrounds", "campground", "campId", dbx.HashExp{"parkId": parkId}, fetched); err != nil {
+		return len(data), err
+	}
+	return len(data), nil
 }
 
-func getMapImage(lat, lon string, firstCome bool) ([]byte, error) {
+func getMapImage(ctx context.Context, client *Client, lat, lon string, firstCome bool) ([]byte, error) {
 	mapboxAPIKey := os.Getenv("MAPBOX_ACCESS_TOKEN")
 	// get map image for the campground (color in url based on whether it's first come first serve)
 	var mapImageURL string
@@ -319,7 +298,7 @@ func getMapImage(lat, lon string, firstCome bool) ([]byte, error) {
 	} else {
 		mapImageURL = fmt.Sprintf("https://api.mapbox.com/styles/v1/mapbox/outdoors-v12/static/pin-l+e85151(%s,%s)/%s,%s,15.2,0/768x384@2x?access_token=%s", lon, lat, lon, lat, mapboxAPIKey)
 	}
-	resp, err := http.Get(mapImageURL)
+	resp, err := client.Get(ctx, mapImageURL)
 	if err != nil {
 		log.Printf("Error fetching map image: %v", err)
 		return nil, err
@@ -341,285 +320,353 @@ func getMapImage(lat, lon string, firstCome bool) ([]byte, error) {
 	return byteImage.Bytes(), nil
 }
 
-// downloadAndResizeImage downloads an image from the given URL and resizes it if it's larger than a maximum width.
-func downloadAndResizeImage(url string, maxWidth int) ([]byte, error) {
-	// get the image from the NPS API URL
-	response, err := http.Get(url)
+// FetchAndStoreWeather fetches the forecast of each national park from the weather provider
+// and stores it in the record. Up to workers parks are refreshed at a time, the requests to
+// each provider wait for its rate limit in the client. A park that fails is counted in the
+// run and skipped, the run only stops early when ctx is done.
+func FetchAndStoreWeather(ctx context.Context, app *pocketbase.PocketBase, provider WeatherProvider, workers int, run *JobRun) error {
+	// get all national parks, except the retired ones
+	parks, err := app.Dao().FindRecordsByExpr("parks", NotRetired)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	sem := semaphore.NewWeighted(int64(max(workers, 1)))
+	var wg sync.WaitGroup
+	var updated, failed atomic.Int32
+	for _, park := range parks {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+			if storeParkWeather(ctx, app, provider, park, run) {
+				updated.Add(1)
+			} else {
+				failed.Add(1)
+			}
+		}()
 	}
-	defer response.Body.Close()
-	// decode the downloaded image
-	img, _, err := image.Decode(response.Body)
+	wg.Wait()
+	log.Printf("Weather updated for %d of %d parks, %d failed", updated.Load(), len(parks), failed.Load())
+	return ctx.Err()
+}
+
+// storeParkWeather fetches and stores the forecast of a park, it returns false if the
+// park keeps its previous forecast
+func storeParkWeather(ctx context.Context, app *pocketbase.PocketBase, provider WeatherProvider, park *models.Record, run *JobRun) bool {
+	code := park.GetString("parkCode")
+	forecast, err := provider.Forecast(ctx, park.GetString("latitude"), park.GetString("longitude"))
 	if err != nil {
-		return nil, err
+		log.Printf("Failed to fetch weather for park %s: %s", code, err)
+		if ctx.Err() == nil {
+			run.Fail("park "+code, err)
+			saveWeatherError(app, park, err)
+		}
+		return false
 	}
-	// resize the image if it's wider than the maxWidth
-	var dst *image.RGBA
-	if img.Bounds().Dx() > maxWidth {
-		dst = image.NewRGBA(image.Rect(0, 0, maxWidth, img.Bounds().Dy()*maxWidth/img.Bounds().Dx()))
-		draw.NearestNeighbor.Scale(dst, dst.Rect, img, img.Bounds(), draw.Over, nil)
-	} else {
-		dst = image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
-		draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	// the hourly forecast is stored in its own collection
+	if err := saveHourlyForecast(app, park.Id, forecast); err != nil {
+		log.Printf("Failed to save hourly forecast for park %s: %s", code, err)
+		run.Error("park "+code, err)
 	}
-	// encode the image back to a byte slice as JPEG
-	buf := new(bytes.Buffer)
-	err = jpeg.Encode(buf, dst, nil)
+	if err := saveWeatherAlerts(app, park.Id, forecast); err != nil {
+		log.Printf("Failed to save weather alerts for park %s: %s", code, err)
+		run.Error("park "+code, err)
+	}
+	// save the weather data to the record
+	jsonData, err := json.Marshal(forecast.Daily)
 	if err != nil {
-		return nil, err
+		log.Printf("Failed to encode weather data for park %s: %s", code, err)
+		run.Fail("park "+code, err)
+		saveWeatherError(app, park, err)
+		return false
+	}
+	park.Set("weather", jsonData)
+	issuedAt := forecast.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+	park.Set("weatherIssuedAt", issuedAt)
+	park.Set("weatherUtcOffset", forecast.UTCOffset)
+	park.Set("weatherError", "")
+	park.Set("weatherErrorAt", "")
+	if err := app.Dao().Save(park); err != nil {
+		log.Printf("Failed to save weather data for park %s: %s", code, err)
+		run.Fail("park "+code, err)
+		return false
+	}
+	run.Updated()
+	log.Printf("Weather data saved for park %s", code)
+	return true
+}
+
+// saveWeatherError records why the forecast of a park couldn't be updated, for the admin,
+// the stored forecast is kept until it is too old to be shown
+func saveWeatherError(app *pocketbase.PocketBase, park *models.Record, err error) {
+	park.Set("weatherError", err.Error())
+	park.Set("weatherErrorAt", types.NowDateTime())
+	if err := app.Dao().SaveRecord(park); err != nil {
+		log.Printf("Failed to save weather error for park %s: %s", park.GetString("parkCode"), err)
 	}
-	dst, img = nil, nil // free up memory
-	return buf.Bytes(), nil
 }
 
-// FetchAndStoreWeather fetches weather data for each national park and stores it in the record.
-func FetchAndStoreWeather(app *pocketbase.PocketBase) error {
-	// get all national parks
-	parks, err := app.Dao().FindRecordsByExpr("parks", nil)
+// addImages adds the new provider images of a park or campground to its form, with their
+// smaller variants, metadata and texts. Downloaded images that look the same as a stored one are
+// skipped, their url is remembered so they are not downloaded again.
+func addImages(ctx context.Context, app *pocketbase.PocketBase, images *ImagePool, form *forms.RecordUpsert, record *models.Record, label string, providerImages []ProviderImage) error {
+	meta, err := completeImageMeta(ctx, app, images, form, record, label)
 	if err != nil {
 		return err
 	}
-	// fetch weather data for each park
-	for _, park := range parks {
-		lon := park.GetString("longitude")
-		lat := park.GetString("latitude")
-		apiUrl, err := buildWeatherAPIUrl(lon, lat)
-		if err != nil {
-			log.Printf("Failed to build weather API URL for park %s: %s", park.GetString("parkCode"), err)
-			continue
-		}
-		weatherData, err := parseWeatherData(apiUrl) // Parse directly from API
-		if err != nil {
-			log.Printf("Failed to fetch weather for park %s: %s", park.GetString("parkCode"), err)
-			continue // Continue with other parks even if one fails
-		}
-		// save the weather data to the record
-		jsonData, err := json.Marshal(weatherData)
-		if err != nil {
-			log.Printf("Failed to encode weather data for park %s: %s", park.GetString("parkCode"), err)
-			return err
+	// refresh the texts of stored photos, duplicates only fill in missing texts
+	details := map[string]ProviderImage{}
+	for _, image := range providerImages {
+		details[image.URL] = image
+		for i := range meta {
+			if meta[i].Source == image.URL || meta[i].hasSource(image.URL) && meta[i].Title == "" && meta[i].AltText == "" {
+				meta[i].setDetails(image)
+			}
 		}
-		park.Set("weather", jsonData)
-		if err := app.Dao().Save(park); err != nil {
-			log.Printf("Failed to save weather data for park %s: %s", park.GetString("parkCode"), err)
-			return err
+	}
+	if imageURLs := newImageURLs(meta, providerImages); len(imageURLs) > 0 {
+		for _, image := range images.Download(ctx, label, imageURLs, 1500) {
+			if original := findDuplicate(meta, image.Hash); original != nil {
+				log.Printf("%s: skipping image %s, it looks the same as %s", label, image.Source, original.File)
+				original.Aliases = append(original.Aliases, image.Source)
+				if original.Title == "" && original.AltText == "" {
+					original.setDetails(details[image.Source])
+				}
+				continue
+			}
+			m := addProcessedImage(form, image, ImageMeta{})
+			m.setDetails(details[image.Source])
+			meta = append(meta, m)
 		}
-		log.Printf("Weather data saved for park %s", park.GetString("parkCode"))
 	}
-	return nil
+	return form.LoadData(map[string]any{"imageMeta": meta})
 }
 
-// ping OpenWeatherMap API
-func buildWeatherAPIUrl(lon, lat string) (string, error) {
-	OWM_API_KEY := os.Getenv("OWM_API_KEY")
-	baseUrl := "https://api.openweathermap.org/data/3.0/onecall"
-	params := url.Values{}
-	params.Add("lat", lat)
-	params.Add("lon", lon)
-	params.Add("exclude", "minutely,hourly")
-	params.Add("appid", OWM_API_KEY)
-
-	url, err := url.Parse(baseUrl)
-	if err != nil {
-		return "", err
+// completeImageMeta returns the metadata of the stored images of a record. Images without
+// metadata, or with metadata from an older version, are processed again and their new
+// variants are added to the form.
+func completeImageMeta(ctx context.Context, app *pocketbase.PocketBase, images *ImagePool, form *forms.RecordUpsert, record *models.Record, label string) ([]ImageMeta, error) {
+	stored := record.GetStringSlice("images")
+	meta := LoadImageMeta(record)
+	// drop the metadata of removed images
+	meta = slices.DeleteFunc(meta, func(m ImageMeta) bool { return !slices.Contains(stored, m.File) })
+	previous := map[string]ImageMeta{}
+	var missing []string
+	for _, file := range stored {
+		m := FindImageMeta(meta, file)
+		if m != nil && m.complete() {
+			continue
+		}
+		// images processed by an older version are processed again, replacing their variants
+		if m != nil {
+			for _, file := range m.variantFiles() {
+				if err := form.RemoveFiles("imageVariants", file); err != nil {
+					return nil, err
+				}
+			}
+			previous[file] = *m
+			meta = slices.DeleteFunc(meta, func(m ImageMeta) bool { return m.File == file })
+		}
+		missing = append(missing, file)
 	}
-	url.RawQuery = params.Encode()
-	return url.String(), nil
-}
-
-func parseWeatherData(apiUrl string) ([]WeatherDate, error) {
-	resp, err := http.Get(apiUrl)
-	if err != nil {
-		return nil, err
+	if len(missing) == 0 {
+		return meta, nil
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	fs, err := app.NewFilesystem()
 	if err != nil {
 		return nil, err
 	}
-	var result struct {
-		Daily []struct {
-			Dt   int64 `json:"dt"`
-			Temp struct {
-				Day   float64 `json:"day"`
-				Night float64 `json:"night"`
-			} `json:"temp"`
-			Weather []struct {
-				Icon string `json:"icon"`
-			} `json:"weather"`
-		} `json:"daily"`
-	}
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return nil, err
+	defer fs.Close()
+	for _, image := range images.Variants(ctx, label, fs, record.BaseFilesPath(), missing) {
+		meta = append(meta, addProcessedImage(form, image, previous[image.Source]))
 	}
-
-	var weatherDates []WeatherDate
-	for _, daily := range result.Daily {
-		date := time.Unix(daily.Dt, 0).Format("Jan 2")
-		dayF := kelvinToFahrenheit(daily.Temp.Day)
-		dayC := kelvinToCelsius(daily.Temp.Day)
-		nightF := kelvinToFahrenheit(daily.Temp.Night)
-		nightC := kelvinToCelsius(daily.Temp.Night)
-		iconURL := fmt.Sprintf("https://openweathermap.org/img/wn/%s@2x.png", daily.Weather[0].Icon)
-
-		weatherDates = append(weatherDates, WeatherDate{
-			Date:              date,
-			TemperatureDayF:   dayF,
-			TemperatureDayC:   dayC,
-			TemperatureNightF: nightF,
-			TemperatureNightC: nightC,
-			WeatherIcon:       iconURL,
-			LastUpdated:       time.Now().Format(time.RFC3339),
-		})
-	}
-	return weatherDates, nil
-}
-
-// Kelvin to Fahrenheit
-func kelvinToFahrenheit(k float64) string {
-	return fmt.Sprintf("%.1f", (k-273.15)*1.8+32)
+	return meta, nil
 }
 
-// Kelvin to Celsius
-func kelvinToCelsius(k float64) string {
-	return fmt.Sprintf("%.1f", k-273.15)
+// addProcessedImage adds a processed image and its variants to the form and returns its
+// metadata, keeping the source, aliases and texts of the previous metadata of stored images
+func addProcessedImage(form *forms.RecordUpsert, image processedImage, previous ImageMeta) ImageMeta {
+	m := ImageMeta{
+		File:        image.Source,
+		Source:      previous.Source,
+		Aliases:     previous.Aliases,
+		Width:       image.Width,
+		Height:      image.Height,
+		Placeholder: image.Placeholder,
+		Color:       image.Color,
+		Hash:        image.Hash,
+		Title:       previous.Title,
+		AltText:     previous.AltText,
+		Caption:     previous.Caption,
+		Credit:      previous.Credit,
+	}
+	if image.File != nil {
+		form.AddFiles("images", image.File)
+		m.File, m.Source = image.File.Name, image.Source
+	}
+	for _, variant := range image.Variants {
+		form.AddFiles("imageVariants", variant.File)
+		m.Variants = append(m.Variants, ImageVariant{File: variant.File.Name, Width: variant.Width})
+	}
+	for _, variant := range image.WebP {
+		form.AddFiles("imageVariants", variant.File)
+		m.WebP = append(m.WebP, ImageVariant{File: variant.File.Name, Width: variant.Width})
+	}
+	return m
 }
 
-func FetchAndStoreWeatherHTTP(app *pocketbase.PocketBase) echo.HandlerFunc {
-	log.Printf("=============== FETCHING WEATHER DATA ===============")
-	return func(c echo.Context) error {
-		err := FetchAndStoreWeather(app)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, err.Error())
+// newImageURLs returns the urls of the provider images that were not downloaded yet
+func newImageURLs(meta []ImageMeta, images []ProviderImage) []string {
+	var urls []string
+	for _, image := range images {
+		if slices.ContainsFunc(meta, func(m ImageMeta) bool { return m.hasSource(image.URL) }) {
+			continue
 		}
-		log.Printf("============= Weather data has been stored successfully. ==============")
-		return c.String(http.StatusOK, "Weather data has been stored successfully.")
+		urls = append(urls, image.URL)
 	}
+	return urls
 }
 
-func FetchAndStoreNationalParksHTTP(app *pocketbase.PocketBase) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		err := FetchAndStoreNationalParks(app)
+// DedupeImages removes the stored photos of parks and campgrounds that look the same as
+// an earlier photo of the same record, along with their variants.
+func DedupeImages(ctx context.Context, app *pocketbase.PocketBase, images *ImagePool) error {
+	for _, collection := range []string{"parks", "campgrounds"} {
+		records, err := app.Dao().FindRecordsByExpr(collection, nil)
 		if err != nil {
-			return c.String(http.StatusInternalServerError, err.Error())
+			return err
 		}
-		return c.String(http.StatusOK, "National Parks data has been stored successfully.")
-	}
-}
-
-// remove file extension and everything to the left of the last /
-func quick_strip_url(s string) string {
-	filename := path.Base(s)                 // Get the filename
-	ext := path.Ext(filename)                // Get the extension
-	return strings.TrimSuffix(filename, ext) // Remove the extension from the filename
-}
-
-// remove everything from the right up to the first underscore from the right, from a given string
-func quick_strip(s string) string {
-	for i := len(s) - 1; i >= 0; i-- {
-		if s[i] == '_' {
-			return s[:i]
+		removed := 0
+		for _, record := range records {
+			label := fmt.Sprintf("%s %s", collection, record.GetString("name"))
+			form := forms.NewRecordUpsert(app, record)
+			meta, err := completeImageMeta(ctx, app, images, form, record, label)
+			if err != nil {
+				log.Printf("Error reading images of %s: %v", label, err)
+				continue
+			}
+			var kept []ImageMeta
+			var duplicates []string
+			for _, file := range record.GetStringSlice("images") {
+				m := FindImageMeta(meta, file)
+				if m == nil {
+					continue
+				}
+				original := findDuplicate(kept, m.Hash)
+				if original == nil {
+					kept = append(kept, *m)
+					continue
+				}
+				log.Printf("%s: removing image %s, it looks the same as %s", label, file, original.File)
+				duplicates = append(duplicates, file)
+				if m.Source != "" {
+					original.Aliases = append(original.Aliases, m.Source)
+				}
+				original.Aliases = append(original.Aliases, m.Aliases...)
+				for _, file := range m.variantFiles() {
+					if err := form.RemoveFiles("imageVariants", file); err != nil {
+						return err
+					}
+				}
+			}
+			if len(duplicates) == 0 && len(form.FilesToUpload()) == 0 {
+				continue
+			}
+			if len(duplicates) > 0 {
+				if err := form.RemoveFiles("images", duplicates...); err != nil {
+					return err
+				}
+			}
+			if err := form.LoadData(map[string]any{"imageMeta": kept}); err != nil {
+				return err
+			}
+			if err := form.Submit(); err != nil {
+				log.Printf("Error saving images of %s: %v", label, err)
+				continue
+			}
+			removed += len(duplicates)
 		}
+		log.Printf("Removed %d duplicate images from %s", removed, collection)
 	}
-	return s
-}
-
-// fetch alerts for each national park
-func FetchParkAlerts(parkCode string) ([]Alert, error) {
-	NPS_API_KEY := os.Getenv("NPS_API_KEY")
-	var NPS_API_URL = "https://developer.nps.gov/api/v1/alerts?parkCode=" + parkCode + "&api_key=" + NPS_API_KEY
-	resp, err := http.Get(NPS_API_URL)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, err
-	}
-	var data struct {
-		Data []struct {
-			Title       string `json:"title"`
-			Description string `json:"description"`
-			Category    string `json:"category"`
-			URL         string `json:"url"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, err
-	}
-	// return Alert struct
-	var alerts []Alert
-	for _, alert := range data.Data {
-		alerts = append(alerts, Alert{
-			Title:       alert.Title,
-			Description: alert.Description,
-			Category:    alert.Category,
-			Url:         alert.URL,
-		})
-	}
-	return alerts, nil
+	return nil
 }
 
-func FetchAlerts(app *pocketbase.PocketBase) error {
-	// remove all alerts records from collection
+// FetchAlerts replaces the stored alerts with the current alerts of every park. The
+// alerts of all parks are fetched first and replaced in a single transaction, so the
+// stored alerts stay in place during the fetch and when the run is cancelled. Parks
+// whose alerts could not be fetched keep their stored alerts.
+func FetchAlerts(ctx context.Context, app *pocketbase.PocketBase, provider ParkProvider, run *JobRun) error {
+	ctx, fetchLog := WithFetchLog(ctx)
+	defer logFetchSummary(provider.Name(), fetchLog)
 	collection, err := app.Dao().FindCollectionByNameOrId("alerts")
 	if err != nil {
 		return err
 	}
-	alerts, err := app.Dao().FindRecordsByExpr(collection.Name, nil)
-	if err != nil {
-		return err
-	}
-	for _, alert := range alerts {
-		if err := app.Dao().Delete(alert); err != nil {
-			return err
-		}
-	}
-	// get all national parks
-	parks, err := app.Dao().FindRecordsByExpr("parks", nil)
+	// get all national parks, except the retired ones
+	parks, err := app.Dao().FindRecordsByExpr("parks", NotRetired)
 	if err != nil {
 		return err
 	}
 	// fetch alerts for each park
+	fetched := map[string][]ProviderAlert{}
+	var failed []string
 	for _, park := range parks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		parkCode := park.GetString("parkCode")
-		alerts, err := FetchParkAlerts(parkCode)
+		alerts, err := provider.ListAlerts(ctx, parkCode)
 		if err != nil {
 			log.Printf("Failed to fetch alerts for park %s: %s", parkCode, err)
+			run.Fail("park "+parkCode, err)
+			failed = append(failed, park.Id)
 			continue
 		}
-		// save the alerts to the record
-		for _, alert := range alerts {
-			record := models.NewRecord(collection)
-			form := forms.NewRecordUpsert(app, record)
-			form.LoadData(map[string]any{
-				"title":       alert.Title,
-				"description": alert.Description,
-				"category":    alert.Category,
-				"url":         alert.Url,
-				"park":        park.Id,
-			})
-			log.Printf("Saving alert for park %s", parkCode)
-			if err := form.Submit(); err != nil {
-				log.Printf("Failed to save alert for park %s: %s", parkCode, err)
+		fetched[park.Id] = alerts
+	}
+	return app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		// remove the alerts of this provider, weather warnings are replaced by the weather job
+		stored, err := txDao.FindRecordsByExpr(collection.Name, dbx.In("source", "", provider.Name()))
+		if err != nil {
+			return err
+		}
+		for _, alert := range stored {
+			if slices.Contains(failed, alert.GetString("park")) {
 				continue
 			}
+			if err := txDao.Delete(alert); err != nil {
+				return err
+			}
 		}
-	}
-	return nil
-}
-
-func FetchAlertsHTTP(app *pocketbase.PocketBase) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		log.Printf("=============== FETCHING ALERTS DATA ===============")
-		err := FetchAlerts(app)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, err.Error())
+		// save the alerts of each park
+		for _, park := range parks {
+			parkCode := park.GetString("parkCode")
+			for _, alert := range fetched[park.Id] {
+				record := models.NewRecord(collection)
+				form := forms.NewRecordUpsert(app, record)
+				form.SetDao(txDao)
+				form.LoadData(map[string]any{
+					"title":       alert.Title,
+					"description": alert.Description,
+					"category":    alert.Category,
+					"url":         alert.URL,
+					"park":        park.Id,
+					"source":      provider.Name(),
+				})
+				log.Printf("Saving alert for park %s", parkCode)
+				if err := form.Submit(); err != nil {
+					log.Printf("Failed to save alert for park %s: %s", parkCode, err)
+					run.Fail("alert of park "+parkCode, err)
+					continue
+				}
+				run.Created()
+			}
 		}
-		log.Printf("============= Alerts data has been stored successfully. ==============")
-		return c.String(http.StatusOK, "Alerts data has been stored successfully.")
-	}
+		return nil
+	})
 }
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// alertsProvider returns the alerts of its parks, and an error for the other parks
+type alertsProvider struct {
+	ParkProvider
+	alerts map[string][]ProviderAlert
+}
+
+func (p alertsProvider) Name() string { return "nps" }
+
+func (p alertsProvider) ListAlerts(ctx context.Context, parkCode string) ([]ProviderAlert, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	alerts, ok := p.alerts[parkCode]
+	if !ok {
+		return nil, errors.New("service unavailable")
+	}
+	return alerts, nil
+}
+
+func saveTestRecord(t *testing.T, app *pocketbase.PocketBase, collection string, data map[string]any) *models.Record {
+	t.Helper()
+	c, err := app.Dao().FindCollectionByNameOrId(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := models.NewRecord(c)
+	record.Load(data)
+	if err := app.Dao().SaveRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func alertTitles(t *testing.T, app *pocketbase.PocketBase) []string {
+	t.Helper()
+	records, err := app.Dao().FindRecordsByExpr("alerts", dbx.NewExp("1=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, record := range records {
+		titles = append(titles, record.GetString("title"))
+	}
+	slices.Sort(titles)
+	return titles
+}
+
+func TestFetchAlerts(t *testing.T) {
+	provider := alertsProvider{alerts: map[string][]ProviderAlert{
+		"yose": {{Title: "Tioga Road closed"}, {Title: "Fire restrictions"}},
+	}}
+	tests := []struct {
+		name      string
+		cancelled bool
+		want      []string
+		failed    int
+	}{
+		{"replaced", false, []string{"Fire restrictions", "Heat warning", "Old deva alert", "Tioga Road closed"}, 1},
+		{"cancelled", true, []string{"Heat warning", "Old deva alert", "Old yose alert"}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(t)
+			yose := saveTestRecord(t, app, "parks", map[string]any{"parkCode": "yose"})
+			deva := saveTestRecord(t, app, "parks", map[string]any{"parkCode": "deva"})
+			saveTestRecord(t, app, "alerts", map[string]any{"park": yose.Id, "title": "Old yose alert", "source": "nps"})
+			saveTestRecord(t, app, "alerts", map[string]any{"park": deva.Id, "title": "Old deva alert", "source": "nps"})
+			saveTestRecord(t, app, "alerts", map[string]any{"park": yose.Id, "title": "Heat warning", "source": "nws"})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if test.cancelled {
+				cancel()
+			}
+			defer cancel()
+			run := &JobRun{Id: "run", Job: JobUpdateAlerts}
+			err := FetchAlerts(ctx, app, provider, run)
+			if test.cancelled != (err != nil) {
+				t.Errorf("FetchAlerts() = %v", err)
+			}
+			// the alerts of deva couldn't be fetched and are kept, the weather warning
+			// isn't an alert of the provider
+			if titles := alertTitles(t, app); !slices.Equal(titles, test.want) {
+				t.Errorf("alerts = %q, want %q", titles, test.want)
+			}
+			if run.Failures() != test.failed {
+				t.Errorf("%d failures, want %d", run.Failures(), test.failed)
+			}
+		})
+	}
+}
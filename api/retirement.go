@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// NotRetired matches the parks and campgrounds shown on the public pages. Records
+// missing from the latest full fetch of the provider get a retiredAt date instead
+// of being deleted, the prune command deletes them for good.
+var NotRetired = dbx.HashExp{"retiredAt": ""}
+
+// IsRetired reports whether a park or campground was removed by the provider
+func IsRetired(record *models.Record) bool {
+	return record.GetString("retiredAt") != ""
+}
+
+// retireMissing retires the records of a collection matching where whose key isn't
+// one of the fetched keys, they are recorded as changes of the run
+func retireMissing(app *pocketbase.PocketBase, run *JobRun, collection string, kind string, key string, where dbx.Expression, fetched []string) error {
+	records, err := app.Dao().FindRecordsByExpr(collection, where, NotRetired)
+	if err != nil {
+		return err
+	}
+	now := types.NowDateTime()
+	for _, record := range records {
+		if slices.Contains(fetched, record.GetString(key)) {
+			continue
+		}
+		item := kind + " " + record.GetString(key)
+		record.Set("retiredAt", now)
+		if err := app.Dao().SaveRecord(record); err != nil {
+			log.Printf("Error retiring %s: %v", item, err)
+			run.Fail(item, err)
+			continue
+		}
+		log.Printf("Retired %s, it is no longer listed by the provider", item)
+		parkId := record.Id
+		if kind == "campground" {
+			parkId = record.GetString("parkId")
+		}
+		saveChanges(app, run, kind, record, parkId, item, []FieldChange{{Field: "retiredAt", New: now.String()}})
+	}
+	return nil
+}
+
+// PruneRetired deletes the retired parks and campgrounds, with their images, alerts
+// and the links to the places they are close to. The campgrounds of a retired park
+// are deleted with it.
+func PruneRetired(ctx context.Context, app *pocketbase.PocketBase) (parks int, campgrounds int, err error) {
+	retiredParks, err := app.Dao().FindRecordsByExpr("parks", dbx.Not(NotRetired))
+	if err != nil {
+		return 0, 0, err
+	}
+	retiredParkIds := make([]any, 0, len(retiredParks))
+	for _, park := range retiredParks {
+		retiredParkIds = append(retiredParkIds, park.Id)
+	}
+	// record files are deleted with the records
+	retiredCampgrounds, err := app.Dao().FindRecordsByExpr("campgrounds", dbx.Or(dbx.Not(NotRetired), dbx.In("parkId", retiredParkIds...)))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, campground := range retiredCampgrounds {
+		if err := ctx.Err(); err != nil {
+			return parks, campgrounds, err
+		}
+		if err := app.Dao().DeleteRecord(campground); err != nil {
+			log.Printf("Error deleting campground %s: %v", campground.GetString("campId"), err)
+			continue
+		}
+		campgrounds++
+	}
+	for _, park := range retiredParks {
+		if err := ctx.Err(); err != nil {
+			return parks, campgrounds, err
+		}
+		if err := prunePark(app, park); err != nil {
+			log.Printf("Error deleting park %s: %v", park.GetString("parkCode"), err)
+			continue
+		}
+		parks++
+	}
+	return parks, campgrounds, nil
+}
+
+func prunePark(app *pocketbase.PocketBase, park *models.Record) error {
+	for _, collection := range []string{"placeParks", "alerts"} {
+		records, err := app.Dao().FindRecordsByExpr(collection, dbx.HashExp{"park": park.Id})
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := app.Dao().DeleteRecord(record); err != nil {
+				return fmt.Errorf("deleting %s: %w", collection, err)
+			}
+		}
+	}
+	return app.Dao().DeleteRecord(park)
+}
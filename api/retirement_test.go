@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func TestPruneKeepsParkChanges(t *testing.T) {
+	app := newTestApp(t)
+	parks, err := app.Dao().FindCollectionByNameOrId("parks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	park := models.NewRecord(parks)
+	park.Set("parkCode", "gone")
+	if err := app.Dao().SaveRecord(park); err != nil {
+		t.Fatal(err)
+	}
+	run := &JobRun{Id: "run", Job: JobUpdateParks}
+	if err := retireMissing(app, run, "parks", "park", "parkCode", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if pruned, _, err := PruneRetired(context.Background(), app); err != nil || pruned != 1 {
+		t.Fatalf("PruneRetired() = %d, %v, want 1 park", pruned, err)
+	}
+	changes, err := app.Dao().FindRecordsByExpr("parkChanges", dbx.HashExp{"recordId": park.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].GetString("parkCode") != "gone" || changes[0].GetString("field") != "retiredAt" {
+		t.Errorf("changes of the pruned park = %v, want its retirement with its park code", changes)
+	}
+}
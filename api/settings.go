@@ -0,0 +1,55 @@
+package api
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+)
+
+// DefaultParkDesignations are stored when no designation allow-list is configured
+var DefaultParkDesignations = []string{"National Park", "National Park & Preserve"}
+
+// ParkDesignations returns the designation allow-list used by park ingestion. The
+// designations of the admin editable settings record take precedence over the
+// PARK_DESIGNATIONS environment variable, a comma separated list of designations, which
+// takes precedence over DefaultParkDesignations. The record is seeded empty, so the
+// environment applies until an admin sets designations. The --designations flag of
+// update-parks overrides all of them.
+func ParkDesignations(app *pocketbase.PocketBase) []string {
+	settings, err := app.Dao().FindRecordsByExpr("settings", nil)
+	if err == nil && len(settings) > 0 {
+		var designations []string
+		if err := settings[0].UnmarshalJSONField("parkDesignations", &designations); err == nil && len(designations) > 0 {
+			return designations
+		}
+	}
+	if designations := ParseDesignations(os.Getenv("PARK_DESIGNATIONS")); len(designations) > 0 {
+		return designations
+	}
+	return DefaultParkDesignations
+}
+
+// ParseDesignations splits a comma separated list of designations
+func ParseDesignations(s string) []string {
+	var designations []string
+	for _, designation := range strings.Split(s, ",") {
+		designation = strings.TrimSpace(designation)
+		if designation != "" {
+			designations = append(designations, designation)
+		}
+	}
+	return designations
+}
+
+// StoredDesignations returns the designations of the parks that aren't retired, in
+// alphabetical order, for the designation filter of the parks near a place
+func StoredDesignations(app *pocketbase.PocketBase) ([]string, error) {
+	var designations []string
+	err := app.Dao().DB().Select("designation").Distinct(true).From("parks").
+		Where(dbx.And(NotRetired, dbx.Not(dbx.HashExp{"designation": ""}))).
+		OrderBy("designation").
+		Column(&designations)
+	return designations, err
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"slices"
+	"testing"
+
+	_ "parkpilot/migrations"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/migrate"
+)
+
+// newTestApp returns an app in a temporary data dir with the pocketbase and parkpilot
+// migrations applied
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+	runner, err := migrate.NewRunner(app.DB(), migrations.AppMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestParkDesignations(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings []string
+		env      string
+		want     []string
+	}{
+		{"defaults", nil, "", DefaultParkDesignations},
+		{"env over the seeded record", nil, "National Monument, National Park", []string{"National Monument", "National Park"}},
+		{"settings over env", []string{"National Seashore"}, "National Monument", []string{"National Seashore"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("PARK_DESIGNATIONS", test.env)
+			app := newTestApp(t)
+			if test.settings != nil {
+				settings, err := app.Dao().FindRecordsByExpr("settings", nil)
+				if err != nil || len(settings) != 1 {
+					t.Fatalf("seeded settings = %v, %v, want one record", settings, err)
+				}
+				settings[0].Set("parkDesignations", test.settings)
+				if err := app.Dao().SaveRecord(settings[0]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := ParkDesignations(app); !slices.Equal(got, test.want) {
+				t.Errorf("ParkDesignations() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDesignationFilter(t *testing.T) {
+	app := newTestApp(t)
+	parks, err := app.Dao().FindCollectionByNameOrId("parks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, park := range []struct{ code, designation, retiredAt string }{
+		{"yose", "National Park", ""},
+		{"cabr", "National Monument", ""},
+		{"deva", "National Park", ""},
+		{"gone", "National Seashore", "2026-01-01 00:00:00.000Z"},
+		{"none", "", ""},
+	} {
+		record := models.NewRecord(parks)
+		record.Set("parkCode", park.code)
+		record.Set("designation", park.designation)
+		record.Set("retiredAt", park.retiredAt)
+		if err := app.Dao().SaveRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	designations, err := StoredDesignations(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"National Monument", "National Park"}; !slices.Equal(designations, want) {
+		t.Errorf("StoredDesignations() = %q, want %q", designations, want)
+	}
+
+	tests := []struct {
+		designation string
+		want        []string
+	}{
+		{"", []string{"cabr", "deva", "none", "yose"}},
+		{"National Park", []string{"deva", "yose"}},
+		{"National Seashore", nil},
+	}
+	for _, test := range tests {
+		options := ParseSortOptions("", "", "", test.designation)
+		records, err := app.Dao().FindRecordsByExpr("parks", options.ParkFilter())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var codes []string
+		for _, record := range records {
+			codes = append(codes, record.GetString("parkCode"))
+		}
+		slices.Sort(codes)
+		if !slices.Equal(codes, test.want) {
+			t.Errorf("parks matching %q = %q, want %q", test.designation, codes, test.want)
+		}
+	}
+}
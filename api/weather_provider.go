@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WeatherProvider is a source of forecasts, e.g. OpenWeatherMap or the National Weather
+// Service. Forecasts are stored as WeatherDate and WeatherHour, whatever their provider.
+type WeatherProvider interface {
+	// Name identifies the provider in logs and in the stored forecasts
+	Name() string
+	// Forecast returns the daily and hourly forecast of the next days at a location
+	Forecast(ctx context.Context, lat, lon string) (*Forecast, error)
+}
+
+// Forecast is the forecast of a location, as returned by a weather provider
+type Forecast struct {
+	Provider string
+	IssuedAt time.Time
+	// offset of the time zone of the location from UTC, in seconds
+	UTCOffset int
+	Daily     []WeatherDate
+	// the next 48 hours, if the provider has an hourly forecast
+	Hourly []WeatherHour
+	// the weather warnings in effect at the location, nil if they couldn't be fetched
+	Alerts []WeatherAlert
+}
+
+// WeatherDate is the forecast of a single day, as stored in the weather field of a park
+type WeatherDate struct {
+	Date              string `json:"date"`
+	Day               string `json:"day"`
+	TemperatureDayF   string `json:"temperatureDayF"`
+	TemperatureDayC   string `json:"temperatureDayC"`
+	TemperatureNightF string `json:"temperatureNightF"`
+	TemperatureNightC string `json:"temperatureNightC"`
+	WeatherIcon       string `json:"weatherIcon"`
+	Summary           string `json:"summary"`
+	// chance of precipitation in percent, and the amounts of rain and snow
+	PrecipProbability string `json:"precipProbability,omitempty"`
+	RainMm            string `json:"rainMm,omitempty"`
+	RainIn            string `json:"rainIn,omitempty"`
+	SnowMm            string `json:"snowMm,omitempty"`
+	SnowIn            string `json:"snowIn,omitempty"`
+	WindMph           string `json:"windMph,omitempty"`
+	WindKmh           string `json:"windKmh,omitempty"`
+	GustMph           string `json:"gustMph,omitempty"`
+	GustKmh           string `json:"gustKmh,omitempty"`
+	WindDirection     string `json:"windDirection,omitempty"`
+	// relative humidity in percent
+	Humidity string `json:"humidity,omitempty"`
+	UVIndex  string `json:"uvIndex,omitempty"`
+	// local times at the park, e.g. 06:42
+	Sunrise   string `json:"sunrise,omitempty"`
+	Sunset    string `json:"sunset,omitempty"`
+	MoonPhase string `json:"moonPhase,omitempty"`
+	Provider  string `json:"provider"`
+}
+
+// IconAlt returns the alt text of the weather icon
+func (d WeatherDate) IconAlt() string {
+	if d.Summary != "" {
+		return d.Summary
+	}
+	return "Weather icon"
+}
+
+// UVRisk returns the WHO exposure category of the UV index
+func (d WeatherDate) UVRisk() string {
+	uvi, err := strconv.ParseFloat(d.UVIndex, 64)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case uvi < 3:
+		return "low"
+	case uvi < 6:
+		return "moderate"
+	case uvi < 8:
+		return "high"
+	case uvi < 11:
+		return "very high"
+	}
+	return "extreme"
+}
+
+// WeatherProviders tries each provider in order until one returns a forecast, so a
+// deployment can use a free provider and fall back to another one.
+type WeatherProviders []WeatherProvider
+
+func (p WeatherProviders) Name() string {
+	names := make([]string, 0, len(p))
+	for _, provider := range p {
+		names = append(names, provider.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (p WeatherProviders) Forecast(ctx context.Context, lat, lon string) (*Forecast, error) {
+	var errs []error
+	for _, provider := range p {
+		forecast, err := provider.Forecast(ctx, lat, lon)
+		if err == nil {
+			return forecast, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no weather provider configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// WeatherConfig holds the settings of the weather providers of a deployment
+type WeatherConfig struct {
+	// Providers are the names of the providers to use in order, "nws" and "owm"
+	Providers []string
+	// OWMAPIKey is the OpenWeatherMap API key
+	OWMAPIKey string
+	// NWSUserAgent identifies the app to the National Weather Service, which requires it
+	NWSUserAgent string
+}
+
+// NewWeatherProvider returns the providers configured for a deployment, in order
+func NewWeatherProvider(client *Client, config WeatherConfig) (WeatherProviders, error) {
+	var providers WeatherProviders
+	for _, name := range config.Providers {
+		switch strings.TrimSpace(name) {
+		case "owm":
+			if config.OWMAPIKey == "" {
+				return nil, errors.New("the owm weather provider needs an API key")
+			}
+			providers = append(providers, NewOWMWeather(client, config.OWMAPIKey))
+		case "nws":
+			if config.NWSUserAgent == "" {
+				return nil, errors.New("the nws weather provider needs a User-Agent")
+			}
+			providers = append(providers, NewNWSWeather(client, config.NWSUserAgent))
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown weather provider %q", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("no weather provider configured")
+	}
+	return providers, nil
+}
+
+// Kelvin to Fahrenheit
+func kelvinToFahrenheit(k float64) string {
+	return fmt.Sprintf("%.1f", (k-273.15)*1.8+32)
+}
+
+// Kelvin to Celsius
+func kelvinToCelsius(k float64) string {
+	return fmt.Sprintf("%.1f", k-273.15)
+}
+
+func fahrenheitToCelsius(f float64) string {
+	return fmt.Sprintf("%.1f", (f-32)/1.8)
+}
+
+func celsiusToFahrenheit(c float64) string {
+	return fmt.Sprintf("%.1f", c*1.8+32)
+}
+
+// precipitation amounts in millimeters and inches
+func precipitation(mm float64) (string, string) {
+	if mm <= 0 {
+		return "", ""
+	}
+	return fmt.Sprintf("%.1f", mm), fmt.Sprintf("%.2f", mm/25.4)
+}
+
+// wind speeds in mph and km/h
+func windSpeed(ms float64) (string, string) {
+	if ms <= 0 {
+		return "", ""
+	}
+	return fmt.Sprintf("%.0f", ms*2.23694), fmt.Sprintf("%.0f", ms*3.6)
+}
+
+// compassDirection returns the direction the wind blows from, e.g. NW
+func compassDirection(deg float64) string {
+	directions := []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+	return directions[int(math.Mod(deg+22.5+360, 360)/45)%8]
+}
+
+// moonPhaseName names a moon phase given as a fraction of the lunar cycle, 0 and 1
+// being new moon and 0.5 full moon
+func moonPhaseName(phase float64) string {
+	switch {
+	case phase < 0.02 || phase > 0.98:
+		return "New moon"
+	case phase < 0.23:
+		return "Waxing crescent"
+	case phase < 0.27:
+		return "First quarter"
+	case phase < 0.48:
+		return "Waxing gibbous"
+	case phase < 0.52:
+		return "Full moon"
+	case phase < 0.73:
+		return "Waning gibbous"
+	case phase < 0.77:
+		return "Last quarter"
+	}
+	return "Waning crescent"
+}
+
+// moonPhase computes the moon phase at a time from a known new moon
+func moonPhase(t time.Time) float64 {
+	const synodicMonth = 29.530588853 * 24 * float64(time.Hour)
+	newMoon := time.Date(2000, time.January, 6, 18, 14, 0, 0, time.UTC)
+	return math.Mod(float64(t.Sub(newMoon))/synodicMonth+1, 1)
+}
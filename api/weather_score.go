@@ -0,0 +1,287 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// sort modes of the parks near a place
+const (
+	SortDistance = "distance"
+	SortWeather  = "weather"
+)
+
+// trips without dates are scored on the next days
+const defaultTripDays = 3
+
+// TripDates is the date range of a trip, as yyyy-mm-dd days. The zero value is a
+// trip without dates.
+type TripDates struct {
+	From string
+	To   string
+}
+
+// ParseTripDates reads the dates of a trip chosen on the index page, an invalid
+// or missing range is a trip without dates
+func ParseTripDates(from, to string) TripDates {
+	start, errFrom := time.Parse(time.DateOnly, from)
+	end, errTo := time.Parse(time.DateOnly, to)
+	if errFrom != nil || errTo != nil || end.Before(start) {
+		return TripDates{}
+	}
+	return TripDates{From: from, To: to}
+}
+
+// IsSet reports whether the trip has dates
+func (t TripDates) IsSet() bool {
+	return t.From != ""
+}
+
+// OrNextDays returns the trip, or the next few days at a UTC offset in seconds if it
+// has no dates
+func (t TripDates) OrNextDays(utcOffset int) TripDates {
+	if t.IsSet() {
+		return t
+	}
+	today := time.Now().In(time.FixedZone("", utcOffset))
+	return TripDates{
+		From: today.Format(time.DateOnly),
+		To:   today.AddDate(0, 0, defaultTripDays-1).Format(time.DateOnly),
+	}
+}
+
+// Contains reports whether a yyyy-mm-dd day is one of the trip
+func (t TripDates) Contains(day string) bool {
+	return t.IsSet() && day != "" && day >= t.From && day <= t.To
+}
+
+// Overlaps reports whether something in effect from start to end happens during the trip,
+// a zero start or end is unbounded
+func (t TripDates) Overlaps(start, end time.Time) bool {
+	if !t.IsSet() {
+		return true
+	}
+	if !end.IsZero() && end.Format(time.DateOnly) < t.From {
+		return false
+	}
+	return start.IsZero() || start.Format(time.DateOnly) <= t.To
+}
+
+// Forecasted reports whether a daily forecast covers at least one day of the trip
+func (t TripDates) Forecasted(weather []WeatherDate) bool {
+	for _, date := range weather {
+		if t.Contains(date.Day) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the dates as query parameters
+func (t TripDates) Query() string {
+	if !t.IsSet() {
+		return ""
+	}
+	return url.Values{"from": {t.From}, "to": {t.To}}.Encode()
+}
+
+// SortOptions is how the parks near a place are sorted and filtered
+type SortOptions struct {
+	Mode string
+	Trip TripDates
+	// Designation of the parks shown, all designations when empty
+	Designation string
+	// Designations offered by the designation filter, see StoredDesignations
+	Designations []string
+}
+
+func ParseSortOptions(mode, from, to, designation string) SortOptions {
+	if mode != SortWeather {
+		mode = SortDistance
+	}
+	return SortOptions{Mode: mode, Trip: ParseTripDates(from, to), Designation: strings.TrimSpace(designation)}
+}
+
+// ParkFilter matches the parks shown with the options, those that aren't retired and
+// have the chosen designation
+func (o SortOptions) ParkFilter() dbx.Expression {
+	if o.Designation == "" {
+		return NotRetired
+	}
+	return dbx.And(NotRetired, dbx.HashExp{"designation": o.Designation})
+}
+
+// Query returns the options as query parameters, for the links of the results page
+func (o SortOptions) Query() string {
+	query := url.Values{}
+	if o.Mode == SortWeather {
+		query.Set("sort", o.Mode)
+	}
+	if o.Trip.IsSet() {
+		query.Set("from", o.Trip.From)
+		query.Set("to", o.Trip.To)
+	}
+	if o.Designation != "" {
+		query.Set("designation", o.Designation)
+	}
+	return query.Encode()
+}
+
+// WeatherScore rates the weather at a park during a trip and the drive to it, from 0 to 100
+type WeatherScore struct {
+	Total         int
+	Temperature   int
+	Precipitation int
+	Wind          int
+	Drive         int
+	// the number of trip days with a forecast, the others are not scored
+	Days int
+}
+
+// weights of the score, the weather ones add up to 1
+const (
+	temperatureWeight   = 0.45
+	precipitationWeight = 0.35
+	windWeight          = 0.2
+	// share of the drive in the total score
+	driveWeight = 0.25
+)
+
+// comfortable temperatures in °C, the score drops to 0 at comfortMargin outside the band
+const (
+	comfortDayMin   = 15.0
+	comfortDayMax   = 27.0
+	comfortNightMin = 4.0
+	comfortNightMax = 18.0
+	comfortMargin   = 12.0
+)
+
+// wind up to calmWind km/h is fine, from stormWind km/h on it scores 0
+const (
+	calmWind  = 15.0
+	stormWind = 50.0
+)
+
+// drives of maxDriveHours or more score 0
+const maxDriveHours = 10.0
+
+// ScoreWeather scores the forecast of a park for the days of a trip, combined with the
+// drive time. Trips without dates are scored on the next days at the park. It returns
+// nil if the park has no forecast for the trip.
+func ScoreWeather(park Park, trip TripDates) *WeatherScore {
+	trip = trip.OrNextDays(park.UTCOffset)
+	var temperature, precipitation, wind float64
+	days := 0
+	for _, date := range park.Weather {
+		if !trip.Contains(date.Day) {
+			continue
+		}
+		days++
+		temperature += (bandScore(date.TemperatureDayC, comfortDayMin, comfortDayMax)*2 +
+			bandScore(date.TemperatureNightC, comfortNightMin, comfortNightMax)) / 3
+		if pop, err := strconv.ParseFloat(date.PrecipProbability, 64); err == nil {
+			precipitation += 1 - pop/100
+		} else {
+			precipitation += 0.5
+		}
+		if kmh, err := strconv.ParseFloat(date.WindKmh, 64); err == nil {
+			wind += clamp01(1 - (kmh-calmWind)/(stormWind-calmWind))
+		} else {
+			wind += 1
+		}
+	}
+	if days == 0 {
+		return nil
+	}
+	temperature, precipitation, wind = temperature/float64(days), precipitation/float64(days), wind/float64(days)
+	drive := 0.5
+	if hours, err := strconv.ParseFloat(park.DriveTime, 64); err == nil {
+		drive = clamp01(1 - hours/maxDriveHours)
+	}
+	weather := temperature*temperatureWeight + precipitation*precipitationWeight + wind*windWeight
+	return &WeatherScore{
+		Total:         percent(weather*(1-driveWeight) + drive*driveWeight),
+		Temperature:   percent(temperature),
+		Precipitation: percent(precipitation),
+		Wind:          percent(wind),
+		Drive:         percent(drive),
+		Days:          days,
+	}
+}
+
+// SortByWeather scores the parks for a trip and sorts them best first, parks without
+// a forecast for the trip come last. Trips without dates are scored on the next days.
+func SortByWeather(parks []Park, trip TripDates) {
+	for i := range parks {
+		parks[i].Score = ScoreWeather(parks[i], trip)
+	}
+	slices.SortStableFunc(parks, func(a, b Park) int {
+		return scoreOf(b) - scoreOf(a)
+	})
+}
+
+func scoreOf(park Park) int {
+	if park.Score == nil {
+		return -1
+	}
+	return park.Score.Total
+}
+
+// bandScore is 1 for a temperature within the band, dropping to 0 at comfortMargin outside it
+func bandScore(celsius string, min, max float64) float64 {
+	c, err := strconv.ParseFloat(celsius, 64)
+	if err != nil {
+		return 0.5
+	}
+	switch {
+	case c < min:
+		return clamp01(1 - (min-c)/comfortMargin)
+	case c > max:
+		return clamp01(1 - (c-max)/comfortMargin)
+	}
+	return 1
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func percent(v float64) int {
+	return int(math.Round(v * 100))
+}
+
+// forecasts issued longer ago than this are stale, they are neither shown nor scored
+const weatherMaxAge = 24 * time.Hour
+
+// LoadWeather returns the daily forecast stored in a park record, from the current day at
+// the park on. It has no days if the forecast is stale.
+func LoadWeather(record *models.Record) []WeatherDate {
+	issuedAt := record.GetDateTime("weatherIssuedAt").Time()
+	if issuedAt.IsZero() || time.Since(issuedAt) > weatherMaxAge {
+		return nil
+	}
+	var weather []WeatherDate
+	if raw := record.GetString("weather"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &weather); err != nil {
+			log.Printf("Invalid weather of park %s: %v", record.GetString("parkCode"), err)
+		}
+	}
+	// the past days stay stored until the next forecast
+	today := time.Now().In(time.FixedZone("", record.GetInt("weatherUtcOffset"))).Format(time.DateOnly)
+	current := weather[:0]
+	for _, date := range weather {
+		if date.Day == "" || date.Day >= today {
+			current = append(current, date)
+		}
+	}
+	return current
+}
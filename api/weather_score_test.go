@@ -0,0 +1,131 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBandScore(t *testing.T) {
+	tests := []struct {
+		celsius string
+		want    float64
+	}{
+		{"20", 1},
+		{"15", 1},
+		{"27", 1},
+		{"9", 0.5},
+		{"33", 0.5},
+		{"3", 0},
+		{"45", 0},
+		{"", 0.5},
+		{"n/a", 0.5},
+	}
+	for _, test := range tests {
+		if got := bandScore(test.celsius, comfortDayMin, comfortDayMax); got != test.want {
+			t.Errorf("bandScore(%q) = %v, want %v", test.celsius, got, test.want)
+		}
+	}
+}
+
+func TestScoreWeather(t *testing.T) {
+	trip := TripDates{From: "2026-07-10", To: "2026-07-11"}
+	comfortable := WeatherDate{Day: "2026-07-10", TemperatureDayC: "20", TemperatureNightC: "10", PrecipProbability: "10", WindKmh: "10"}
+	tests := []struct {
+		name      string
+		weather   []WeatherDate
+		driveTime string
+		want      *WeatherScore
+	}{
+		{"comfortable", []WeatherDate{comfortable}, "2",
+			&WeatherScore{Total: 92, Temperature: 100, Precipitation: 90, Wind: 100, Drive: 80, Days: 1}},
+		{"missing fields", []WeatherDate{{Day: "2026-07-10"}}, "0",
+			&WeatherScore{Total: 70, Temperature: 50, Precipitation: 50, Wind: 100, Drive: 100, Days: 1}},
+		{"storm and a long drive", []WeatherDate{{Day: "2026-07-10", TemperatureDayC: "3", TemperatureNightC: "-8", PrecipProbability: "100", WindKmh: "50"}}, "12",
+			&WeatherScore{Total: 0, Days: 1}},
+		{"averaged over the trip days", []WeatherDate{
+			{Day: "2026-07-09", TemperatureDayC: "45", PrecipProbability: "100", WindKmh: "90"},
+			{Day: "2026-07-10", TemperatureDayC: "20", TemperatureNightC: "10", PrecipProbability: "0", WindKmh: "10"},
+			{Day: "2026-07-11", TemperatureDayC: "33", TemperatureNightC: "10", PrecipProbability: "50", WindKmh: "32.5"},
+		}, "0",
+			&WeatherScore{Total: 84, Temperature: 83, Precipitation: 75, Wind: 75, Drive: 100, Days: 2}},
+		{"no forecast for the trip", []WeatherDate{{Day: "2026-07-12", TemperatureDayC: "20"}}, "1", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ScoreWeather(Park{Weather: test.weather, DriveTime: test.driveTime}, trip)
+			if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+				t.Errorf("ScoreWeather() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSortByWeather(t *testing.T) {
+	trip := TripDates{From: "2026-07-10", To: "2026-07-10"}
+	park := func(code string, weather ...WeatherDate) Park {
+		return Park{ParkCode: code, Weather: weather, DriveTime: "0"}
+	}
+	parks := []Park{
+		park("none"),
+		park("fair", WeatherDate{Day: "2026-07-10"}),
+		park("later", WeatherDate{Day: "2026-07-11", TemperatureDayC: "20"}),
+		park("best", WeatherDate{Day: "2026-07-10", TemperatureDayC: "20", TemperatureNightC: "10", PrecipProbability: "0", WindKmh: "5"}),
+		park("worst", WeatherDate{Day: "2026-07-10", TemperatureDayC: "-20", TemperatureNightC: "-20", PrecipProbability: "100", WindKmh: "80"}),
+	}
+	SortByWeather(parks, trip)
+
+	// parks without a forecast for the trip come last, in their previous order
+	want := []string{"best", "fair", "worst", "none", "later"}
+	for i, park := range parks {
+		if park.ParkCode != want[i] {
+			t.Fatalf("park %d = %s, want the order %v", i, park.ParkCode, want)
+		}
+	}
+	if parks[3].Score != nil || parks[4].Score != nil {
+		t.Error("parks without a forecast for the trip have a score")
+	}
+}
+
+func TestSortByWeatherWithoutDates(t *testing.T) {
+	// the current day at the park is scored, even when it is another day in UTC
+	for _, offset := range []int{-12 * 3600, 0, 14 * 3600} {
+		today := time.Now().In(time.FixedZone("", offset)).Format(time.DateOnly)
+		parks := []Park{{UTCOffset: offset, Weather: []WeatherDate{{Day: today, TemperatureDayC: "20"}}}}
+		SortByWeather(parks, TripDates{})
+		if parks[0].Score == nil || parks[0].Score.Days != 1 {
+			t.Errorf("offset %d: score = %+v, want today %s scored", offset, parks[0].Score, today)
+		}
+	}
+}
+
+func TestTripOverlaps(t *testing.T) {
+	trip := TripDates{From: "2026-07-10", To: "2026-07-12"}
+	day := func(s string) time.Time {
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tests := []struct {
+		name       string
+		trip       TripDates
+		start, end time.Time
+		want       bool
+	}{
+		{"trip without dates", TripDates{}, day("2026-01-01"), day("2026-01-02"), true},
+		{"unbounded", trip, time.Time{}, time.Time{}, true},
+		{"ends before the trip", trip, day("2026-07-01"), day("2026-07-09"), false},
+		{"ends on the first day", trip, day("2026-07-01"), day("2026-07-10"), true},
+		{"starts on the last day", trip, day("2026-07-12"), day("2026-07-20"), true},
+		{"starts after the trip", trip, day("2026-07-13"), day("2026-07-20"), false},
+		{"no start", trip, time.Time{}, day("2026-07-11"), true},
+		{"no end", trip, day("2026-07-11"), time.Time{}, true},
+		{"no end, starts after the trip", trip, day("2026-07-13"), time.Time{}, false},
+	}
+	for _, test := range tests {
+		if got := test.trip.Overlaps(test.start, test.end); got != test.want {
+			t.Errorf("%s: Overlaps() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build cgo
+
+package api
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/chai2010/webp"
+)
+
+// WebPSupported reports whether WebP copies of the photos are stored, the encoder is
+// libwebp and needs cgo
+const WebPSupported = true
+
+func encodeWebP(img image.Image) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := webp.Encode(buf, img, &webp.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,16 @@
+//go:build !cgo
+
+package api
+
+import (
+	"errors"
+	"image"
+)
+
+// WebPSupported reports whether WebP copies of the photos are stored, builds without cgo
+// only store JPEG photos
+const WebPSupported = false
+
+func encodeWebP(img image.Image) ([]byte, error) {
+	return nil, errors.New("WebP encoding needs cgo")
+}
@@ -0,0 +1,38 @@
+package components
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"parkpilot/api"
+)
+
+func TestParkInfoWithoutForecast(t *testing.T) {
+	park := api.Park{FullName: "Yosemite National Park", ParkCode: "yose"}
+	trip := api.TripDates{From: time.Now().Format(time.DateOnly), To: time.Now().AddDate(0, 0, 2).Format(time.DateOnly)}
+	for _, trip := range []api.TripDates{{}, trip} {
+		var html strings.Builder
+		if err := ParkInfo(park, "", nil, trip).Render(context.Background(), &html); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(html.String(), "Forecast unavailable") {
+			t.Errorf("a park without forecast doesn't say so, trip %+v", trip)
+		}
+	}
+}
+
+func TestAlertPeriodAtPark(t *testing.T) {
+	alert := api.Alert{
+		Source:    "nws",
+		Severity:  "Severe",
+		Effective: time.Date(2026, 7, 10, 18, 0, 0, 0, time.UTC),
+		Expires:   time.Date(2026, 7, 11, 3, 0, 0, 0, time.UTC),
+	}
+	// the times are those at the park, whatever the time zone of the server
+	want := "Weather warning, Severe from Jul 10 11:00 until Jul 10 20:00 -0700 (NWS)"
+	if got := alertPeriod(alert, -7*3600); got != want {
+		t.Errorf("alertPeriod() = %q, want %q", got, want)
+	}
+}
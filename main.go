@@ -1,15 +1,22 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"parkpilot/api"
 	"parkpilot/components"
+	_ "parkpilot/migrations"
 	"parkpilot/template"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v5"
@@ -18,10 +25,20 @@ import (
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/plugins/migratecmd"
 	"github.com/pocketbase/pocketbase/tools/cron"
 	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
 )
 
+// placeURL is the url of the results page of a place, with its sort options
+func placeURL(placeName, stateName string, options api.SortOptions) string {
+	if query := options.Query(); query != "" {
+		return "/place/" + placeName + "/" + stateName + "?" + query
+	}
+	return "/place/" + placeName + "/" + stateName
+}
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -30,6 +47,9 @@ func main() {
 
 	app := pocketbase.New()
 
+	// adds the migrate command, collection changes live in ./migrations
+	migratecmd.MustRegister(app, app.RootCmd, migratecmd.Config{})
+
 	// Read the environment variable
 	mapboxAccessToken := os.Getenv("MAPBOX_ACCESS_TOKEN")
 	npsApiKey := os.Getenv("NPS_API_KEY")
@@ -41,26 +61,140 @@ func main() {
 	if npsApiKey == "" {
 		log.Fatal("NPS_API_KEY environment variable is not set")
 	}
-	if owmApikey == "" {
-		log.Fatal("OWM_API_KEY environment variable is not set")
+	if !api.WebPSupported {
+		log.Println("Built without cgo, photos are stored without WebP copies")
 	}
 
-	// capture console commands to update data manually
-	app.RootCmd.AddCommand(&cobra.Command{
+	// every outbound API call goes through this client, paid OpenWeatherMap plans
+	// allow more than the 60 calls per minute of the free one
+	policies := api.DefaultHostPolicies()
+	if perMinute := os.Getenv("OWM_CALLS_PER_MINUTE"); perMinute != "" {
+		calls, err := strconv.Atoi(perMinute)
+		if err != nil || calls <= 0 {
+			log.Fatal("OWM_CALLS_PER_MINUTE environment variable is not a positive number")
+		}
+		policy := policies["api.openweathermap.org"]
+		policy.Rate = rate.Every(time.Minute / time.Duration(calls))
+		policies["api.openweathermap.org"] = policy
+	}
+	httpClient := api.NewClient(policies)
+	// park and campground photos are processed by a pool of IMAGE_WORKERS workers,
+	// using at most IMAGE_MEMORY_MB of memory for the photos read and decoded
+	imageWorkers, imageMemoryMB := 4, 512
+	if workers := os.Getenv("IMAGE_WORKERS"); workers != "" {
+		imageWorkers, err = strconv.Atoi(workers)
+		if err != nil {
+			log.Fatal("IMAGE_WORKERS environment variable is not a number")
+		}
+	}
+	if memory := os.Getenv("IMAGE_MEMORY_MB"); memory != "" {
+		imageMemoryMB, err = strconv.Atoi(memory)
+		if err != nil {
+			log.Fatal("IMAGE_MEMORY_MB environment variable is not a number")
+		}
+	}
+	imagePool := api.NewImagePool(httpClient, imageWorkers, int64(imageMemoryMB)<<20)
+	// park data is read from the National Park Service API
+	parkProvider := api.NewNPSProvider(httpClient, npsApiKey)
+	if pageSize := os.Getenv("NPS_PAGE_SIZE"); pageSize != "" {
+		parkProvider.PageSize, err = strconv.Atoi(pageSize)
+		if err != nil || parkProvider.PageSize <= 0 {
+			log.Fatal("NPS_PAGE_SIZE environment variable is not a positive number")
+		}
+	}
+
+	// forecasts come from the WEATHER_PROVIDERS in order, the next one is used when one
+	// fails, e.g. nws,owm uses the National Weather Service and OpenWeatherMap outside the US
+	weatherProviders := []string{"owm"}
+	if providers := os.Getenv("WEATHER_PROVIDERS"); providers != "" {
+		weatherProviders = strings.Split(providers, ",")
+	}
+	weatherProvider, err := api.NewWeatherProvider(httpClient, api.WeatherConfig{
+		Providers:    weatherProviders,
+		OWMAPIKey:    owmApikey,
+		NWSUserAgent: os.Getenv("NWS_USER_AGENT"),
+	})
+	if err != nil {
+		log.Fatalf("Invalid weather providers: %v", err)
+	}
+	// forecasts of WEATHER_WORKERS parks are fetched at a time
+	weatherWorkers := 4
+	if workers := os.Getenv("WEATHER_WORKERS"); workers != "" {
+		weatherWorkers, err = strconv.Atoi(workers)
+		if err != nil {
+			log.Fatal("WEATHER_WORKERS environment variable is not a number")
+		}
+	}
+	// air quality comes from AIR_QUALITY_PROVIDER, owm or airnow with AIRNOW_API_KEY,
+	// it defaults to owm when OpenWeatherMap is configured and is disabled otherwise
+	airQualityName := os.Getenv("AIR_QUALITY_PROVIDER")
+	if airQualityName == "" && owmApikey != "" {
+		airQualityName = "owm"
+	}
+	var airQualityProvider api.AirQualityProvider
+	if airQualityName != "" {
+		airQualityProvider, err = api.NewAirQualityProvider(httpClient, api.AirQualityConfig{
+			Provider:     airQualityName,
+			OWMAPIKey:    owmApikey,
+			AirNowAPIKey: os.Getenv("AIRNOW_API_KEY"),
+		})
+		if err != nil {
+			log.Fatalf("Invalid air quality provider: %v", err)
+		}
+	}
+
+	// signs the API tokens of the refresh endpoints, without it only admins can use them
+	apiTokenSecret := os.Getenv("API_TOKEN_SECRET")
+
+	// long running work goes through the job queue, shared by the cron scheduler,
+	// the console commands and the refresh endpoints
+	jobs := api.NewJobQueue(app)
+	jobs.Register(api.JobUpdateParks, func(ctx context.Context, run *api.JobRun) error {
+		var designations []string
+		if !run.Param("designations", &designations) {
+			designations = api.ParkDesignations(app)
+		}
+		return api.FetchAndStoreParks(ctx, app, httpClient, imagePool, parkProvider, designations, run)
+	})
+	jobs.Register(api.JobUpdateWeather, func(ctx context.Context, run *api.JobRun) error {
+		return api.FetchAndStoreWeather(ctx, app, weatherProvider, weatherWorkers, run)
+	})
+	jobs.Register(api.JobUpdateAlerts, func(ctx context.Context, run *api.JobRun) error {
+		return api.FetchAlerts(ctx, app, parkProvider, run)
+	})
+	if airQualityProvider != nil {
+		jobs.Register(api.JobUpdateAirQuality, func(ctx context.Context, run *api.JobRun) error {
+			return api.FetchAndStoreAirQuality(ctx, app, airQualityProvider, run)
+		})
+	}
+
+	// capture console commands to update data manually, they run the job in this process
+	var designations []string
+	updateParksCmd := &cobra.Command{
 		Use: "update-parks",
 		Run: func(cmd *cobra.Command, args []string) {
-			err := api.FetchAndStoreNationalParks(app)
+			var params map[string]any
+			if len(designations) > 0 {
+				params = map[string]any{"designations": designations}
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			err := jobs.RunNow(ctx, api.JobUpdateParks, api.TriggerCLI, params)
 			if err != nil {
 				log.Println("Error fetching National Parks data:", err)
 			} else {
 				log.Println("National Parks data updated!")
 			}
 		},
-	})
+	}
+	updateParksCmd.Flags().StringSliceVar(&designations, "designations", nil, "park designations to store, overrides the settings record and PARK_DESIGNATIONS")
+	app.RootCmd.AddCommand(updateParksCmd)
 	app.RootCmd.AddCommand(&cobra.Command{
 		Use: "update-weather",
 		Run: func(cmd *cobra.Command, args []string) {
-			err := api.FetchAndStoreWeather(app)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			err := jobs.RunNow(ctx, api.JobUpdateWeather, api.TriggerCLI, nil)
 			if err != nil {
 				log.Println("Error fetching Weather data:", err)
 			} else {
@@ -71,7 +205,9 @@ func main() {
 	app.RootCmd.AddCommand(&cobra.Command{
 		Use: "update-alerts",
 		Run: func(cmd *cobra.Command, args []string) {
-			err := api.FetchAlerts(app)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			err := jobs.RunNow(ctx, api.JobUpdateAlerts, api.TriggerCLI, nil)
 			if err != nil {
 				log.Println("Error fetching Alerts data:", err)
 			} else {
@@ -79,6 +215,97 @@ func main() {
 			}
 		},
 	})
+	// air quality is only available with a configured provider
+	if airQualityProvider != nil {
+		app.RootCmd.AddCommand(&cobra.Command{
+			Use: "update-air-quality",
+			Run: func(cmd *cobra.Command, args []string) {
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+				defer stop()
+				err := jobs.RunNow(ctx, api.JobUpdateAirQuality, api.TriggerCLI, nil)
+				if err != nil {
+					log.Println("Error fetching Air Quality data:", err)
+				} else {
+					log.Println("Air Quality data updated!")
+				}
+			},
+		})
+	}
+	app.RootCmd.AddCommand(&cobra.Command{
+		Use:   "dedupe-images",
+		Short: "Remove park and campground photos that look the same as another photo of the same record",
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			err := api.DedupeImages(ctx, app, imagePool)
+			if err != nil {
+				log.Println("Error removing duplicate images:", err)
+			} else {
+				log.Println("Duplicate images removed!")
+			}
+		},
+	})
+
+	app.RootCmd.AddCommand(&cobra.Command{
+		Use:   "prune",
+		Short: "Delete the parks and campgrounds no longer listed by the park provider, with their images and place links",
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			parks, campgrounds, err := api.PruneRetired(ctx, app)
+			if err != nil {
+				log.Println("Error pruning retired parks:", err)
+			} else {
+				log.Printf("Pruned %d retired parks and %d retired campgrounds!", parks, campgrounds)
+			}
+		},
+	})
+
+	var climatePark, climateSource string
+	importClimateCmd := &cobra.Command{
+		Use:   "import-climate [file]",
+		Short: "Import monthly climate normals of the parks from a CSV file, in our own format or a NOAA monthly normals file",
+		Long: `Import monthly climate normals of the parks from a CSV file.
+
+The file has a header row with the columns parkCode, month, highF or highC, lowF or lowC,
+precipIn or precipMm, precipDays and snowIn or snowCm. NOAA 1991-2020 monthly normals files
+of a station are read as well, with --park set to the park of the station.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			file, err := os.Open(args[0])
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			source := climateSource
+			if source == "" {
+				source = filepath.Base(args[0])
+			}
+			imported, skipped, err := api.ImportClimateNormals(app, file, climatePark, source)
+			if err != nil {
+				log.Printf("Error importing climate normals after %d months, %d rows skipped: %v", imported, skipped, err)
+			} else {
+				log.Printf("Imported %d months of climate normals, %d rows skipped!", imported, skipped)
+			}
+		},
+	}
+	importClimateCmd.Flags().StringVar(&climatePark, "park", "", "park code of the rows without one, like the rows of a NOAA station file")
+	importClimateCmd.Flags().StringVar(&climateSource, "source", "", "where the normals come from, defaults to the file name")
+	app.RootCmd.AddCommand(importClimateCmd)
+
+	var tokenTTL time.Duration
+	apiTokenCmd := &cobra.Command{
+		Use:   "api-token",
+		Short: "Print an API token for the data refresh endpoints, signed with API_TOKEN_SECRET",
+		Run: func(cmd *cobra.Command, args []string) {
+			if apiTokenSecret == "" {
+				log.Fatal("API_TOKEN_SECRET environment variable is not set")
+			}
+			fmt.Println(api.SignAPIToken(apiTokenSecret, time.Now().Add(tokenTTL)))
+		},
+	}
+	apiTokenCmd.Flags().DurationVar(&tokenTTL, "ttl", 30*24*time.Hour, "how long the token is valid")
+	app.RootCmd.AddCommand(apiTokenCmd)
 
 	// serves static files from the provided public dir (if exists)
 	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
@@ -95,7 +322,7 @@ func main() {
 			parks := []api.Park{}
 			placeName := ""
 			stateName := ""
-			return template.Html(c, components.Index(mapboxAccessToken, parks, placeName, stateName))
+			return template.Html(c, components.Index(mapboxAccessToken, parks, placeName, stateName, api.SortOptions{}))
 		})
 
 		e.Router.GET("/offline", func(c echo.Context) error {
@@ -105,6 +332,7 @@ func main() {
 		e.Router.GET("/park/:parkCode", func(c echo.Context) error {
 			parkCode := c.PathParam("parkCode")
 			queryName := c.QueryParam("q")
+			trip := api.ParseTripDates(c.QueryParam("from"), c.QueryParam("to"))
 			var placeRecord *models.Record
 			// Proceed only if queryName is provided
 			if queryName != "" {
@@ -116,7 +344,7 @@ func main() {
 			var parkPlaceRecord *models.Record // Define outside to check later
 			// regardless of queryParams, proceed to fetch park data
 			parkRecord, err := app.Dao().FindFirstRecordByData("parks", "parkCode", parkCode)
-			if err != nil {
+			if err != nil || api.IsRetired(parkRecord) {
 				return c.JSON(http.StatusNotFound, map[string]string{"error": "Park not found"})
 			}
 			// check if parkCode is already in collection "parks" under field "parkCode"
@@ -126,32 +354,29 @@ func main() {
 				park.Description = parkRecord.GetString("description")
 				park.States = parkRecord.GetString("states")
 				park.Images = parkRecord.Get("images").([]string)
+				park.ImageMeta = api.LoadImageMeta(parkRecord)
 				park.Longitude = parkRecord.GetString("longitude")
 				park.Latitude = parkRecord.GetString("latitude")
 				park.WeatherInfo = parkRecord.GetString("weatherInfo")
 				park.DirectionsInfo = parkRecord.GetString("directionsInfo")
 				park.ParkRecordId = parkRecord.Id
 				park.ParkCode = parkCode
+				park.Designation = parkRecord.GetString("designation")
 				park.Campgrounds = parkRecord.GetInt("campgrounds")
-				var weatherData []api.WeatherDate
-				err := json.Unmarshal([]byte(parkRecord.GetString("weather")), &weatherData)
+				// the current days of the forecast, none if it is stale
+				park.Weather = api.LoadWeather(parkRecord)
+				park.UTCOffset = parkRecord.GetInt("weatherUtcOffset")
+				park.WeatherIssuedAt = parkRecord.GetDateTime("weatherIssuedAt").Time()
+				park.AirQuality = api.LoadAirQuality(parkRecord)
+				park.Climate, err = api.LoadClimate(app, parkRecord.Id)
 				if err != nil {
-					log.Println("Error unmarshaling JSON:", err)
+					log.Println("Error loading climate normals:", err)
 				}
-				park.Weather = weatherData
-				var alerts []api.Alert
-				alertRecords, err := app.Dao().FindRecordsByExpr("alerts", dbx.HashExp{"park": parkRecord.Id})
+				// park alerts and weather warnings that haven't expired, during the trip if it has dates
+				alerts, err := api.ActiveAlerts(app, parkRecord.Id, trip)
 				if err != nil {
 					return c.String(http.StatusInternalServerError, err.Error())
 				}
-				for _, alertRecord := range alertRecords {
-					var alert api.Alert
-					alert.Title = alertRecord.GetString("title")
-					alert.Description = alertRecord.GetString("description")
-					alert.Category = alertRecord.GetString("category")
-					alert.Url = alertRecord.GetString("url")
-					alerts = append(alerts, alert)
-				}
 				placeName := ""
 				if queryName != "" {
 					tmp, err := app.Dao().FindRecordsByExpr("placeParks", dbx.HashExp{"park": parkRecord.Id, "place": placeRecord.Id})
@@ -171,9 +396,9 @@ func main() {
 
 				// if contains HX-Request header:
 				if c.Request().Header.Get("HX-Request") == "true" {
-					return template.Html(c, components.ParkInfo(park, placeName, alerts))
+					return template.Html(c, components.ParkInfo(park, placeName, alerts, trip))
 				} else {
-					return template.Html(c, components.Park(park, placeName, alerts))
+					return template.Html(c, components.Park(park, placeName, alerts, trip))
 				}
 			} else {
 				// Redirect to home page if park not found
@@ -181,16 +406,29 @@ func main() {
 			}
 		})
 
+		// hourly forecast chart of the park page, loaded by htmx
+		e.Router.GET("/park/:parkCode/hourly", func(c echo.Context) error {
+			parkRecord, err := app.Dao().FindFirstRecordByData("parks", "parkCode", c.PathParam("parkCode"))
+			if err != nil || api.IsRetired(parkRecord) {
+				return c.String(http.StatusNotFound, "Park not found")
+			}
+			forecast, err := api.LatestHourlyForecast(app, parkRecord.Id)
+			if err != nil {
+				return c.String(http.StatusInternalServerError, err.Error())
+			}
+			return template.Html(c, components.HourlyForecast(forecast))
+		})
+
 		e.Router.GET("/campgrounds/:parkCode", func(c echo.Context) error {
 			parkCode := c.PathParam("parkCode")
 			parkRecord, err := app.Dao().FindFirstRecordByData("parks", "parkCode", parkCode)
 			if err != nil {
 				return c.String(http.StatusInternalServerError, err.Error())
 			}
-			if parkRecord != nil {
+			if parkRecord != nil && !api.IsRetired(parkRecord) {
 				var campgrounds []api.Campground
 				// get campgrounds associated with the park
-				campgroundRecords, err := app.Dao().FindRecordsByExpr("campgrounds", dbx.HashExp{"parkId": parkRecord.Id})
+				campgroundRecords, err := app.Dao().FindRecordsByExpr("campgrounds", dbx.HashExp{"parkId": parkRecord.Id}, api.NotRetired)
 				if err != nil {
 					return c.String(http.StatusInternalServerError, err.Error())
 				}
@@ -234,7 +472,7 @@ func main() {
 			if err != nil {
 				return c.String(http.StatusInternalServerError, err.Error())
 			}
-			if campgroundRecord != nil {
+			if campgroundRecord != nil && !api.IsRetired(campgroundRecord) {
 				var campground api.Campground
 				campground.Name = campgroundRecord.GetString("name")
 				campground.Description = campgroundRecord.GetString("description")
@@ -247,11 +485,15 @@ func main() {
 				campground.ReservationURL = campgroundRecord.GetString("reservationUrl")
 				campground.DirectionsOverview = campgroundRecord.GetString("directionsOverview")
 				campground.Images = campgroundRecord.GetStringSlice("images")
+				campground.ImageMeta = api.LoadImageMeta(campgroundRecord)
 				campground.WeatherOverview = campgroundRecord.GetString("weatherOverview")
 				park, err := app.Dao().FindRecordById("parks", campgroundRecord.GetString("parkId"))
 				if err != nil {
 					return c.String(http.StatusInternalServerError, err.Error())
 				}
+				if api.IsRetired(park) {
+					return c.Redirect(http.StatusFound, "/")
+				}
 				campground.ParkCode = park.GetString("parkCode")
 				parkName := park.GetString("name")
 				Id := campgroundRecord.Id
@@ -269,15 +511,27 @@ func main() {
 			placeName := c.PathParam("placeName")
 			stateName := c.PathParam("stateName")
 			queryName := placeName + "," + stateName
+			// parks are sorted by distance, or by the weather during the trip, and may be
+			// limited to a designation
+			options := api.ParseSortOptions(c.QueryParam("sort"), c.QueryParam("from"), c.QueryParam("to"), c.QueryParam("designation"))
+			designations, err := api.StoredDesignations(app)
+			if err != nil {
+				return c.String(http.StatusInternalServerError, err.Error())
+			}
+			options.Designations = designations
 			// check if placeName is already in collection "places" under field "placeName"
 			placeRecord, _ := app.Dao().FindFirstRecordByData("places", "placeName", queryName)
 			if placeRecord != nil {
 				// get the parks associated with the place
 				placeParks, err := app.Dao().FindRecordsByExpr("placeParks", dbx.HashExp{"place": placeRecord.Id})
-				placeParks = placeParks[:8]
 				if err != nil {
 					return err
 				}
+				// every park with a known drive is a candidate for the best weather or the
+				// designation
+				if options.Mode != api.SortWeather && options.Designation == "" {
+					placeParks = placeParks[:min(8, len(placeParks))]
+				}
 				parks := []api.Park{}
 				for _, placePark := range placeParks {
 					parkId := placePark.GetStringSlice("park")[0]
@@ -285,11 +539,18 @@ func main() {
 					if err != nil {
 						return c.String(http.StatusInternalServerError, err.Error())
 					}
+					if api.IsRetired(parkRecord) {
+						continue
+					}
+					if options.Designation != "" && parkRecord.GetString("designation") != options.Designation {
+						continue
+					}
 					var park api.Park
 					park.FullName = parkRecord.GetString("name")
 					park.Description = parkRecord.GetString("description")
 					park.States = parkRecord.GetString("states")
 					park.Images = parkRecord.Get("images").([]string)
+					park.ImageMeta = api.LoadImageMeta(parkRecord)
 					park.Longitude = parkRecord.GetString("longitude")
 					park.Latitude = parkRecord.GetString("latitude")
 					park.ParkRecordId = parkRecord.Id
@@ -297,18 +558,28 @@ func main() {
 					park.DrivingDistanceMi = placePark.GetString("drivingDistanceMi")
 					park.DrivingDistanceKm = placePark.GetString("drivingDistanceKm")
 					park.ParkCode = parkRecord.GetString("parkCode")
+					park.Designation = parkRecord.GetString("designation")
+					park.Weather = api.LoadWeather(parkRecord)
+					park.UTCOffset = parkRecord.GetInt("weatherUtcOffset")
+					park.AirQuality = api.LoadAirQuality(parkRecord)
 					parks = append(parks, park)
 				}
+				if options.Mode == api.SortWeather {
+					api.SortByWeather(parks, options.Trip)
+				}
+				// parks with unhealthy air during the trip come after the others
+				api.DeprioritizeUnhealthyAir(parks, options.Trip)
+				parks = parks[:min(8, len(parks))]
 				// return all info from DB
 				if c.Request().Header.Get("HX-Request") == "true" {
-					c.Response().Header().Set("HX-Push-Url", "/place/"+placeName+"/"+stateName)
-					return template.Html(c, components.Parks(parks, placeName, stateName))
+					c.Response().Header().Set("HX-Push-Url", placeURL(placeName, stateName, options))
+					return template.Html(c, components.Parks(parks, placeName, stateName, options))
 				} else {
-					return template.Html(c, components.Index(mapboxAccessToken, parks, placeName, stateName))
+					return template.Html(c, components.Index(mapboxAccessToken, parks, placeName, stateName, options))
 				}
 			} else {
 				// get all records from parks collection
-				records, err := app.Dao().FindRecordsByExpr("parks", nil)
+				records, err := app.Dao().FindRecordsByExpr("parks", options.ParkFilter())
 				if err != nil {
 					return c.String(http.StatusInternalServerError, err.Error())
 				}
@@ -320,10 +591,15 @@ func main() {
 					park.Description = record.GetString("description")
 					park.States = record.GetString("states")
 					park.Images = record.Get("images").([]string)
+					park.ImageMeta = api.LoadImageMeta(record)
 					park.Longitude = record.GetString("longitude")
 					park.Latitude = record.GetString("latitude")
 					park.ParkRecordId = record.Id
 					park.ParkCode = record.GetString("parkCode")
+					park.Designation = record.GetString("designation")
+					park.Weather = api.LoadWeather(record)
+					park.UTCOffset = record.GetInt("weatherUtcOffset")
+					park.AirQuality = api.LoadAirQuality(record)
 					parks = append(parks, park)
 				}
 				// if not, add it with latitude and longitude and associate it with closest national parks
@@ -349,8 +625,12 @@ func main() {
 				if err := app.Dao().SaveRecord(placeRecord); err != nil {
 					return err
 				}
-				// Fetch driving distances
-				parks, err = api.FetchDrivingDistances([2]float64{latitude, longitude}, parks, 8)
+				// Fetch driving distances, of every park when they are sorted by weather
+				count := 8
+				if options.Mode == api.SortWeather {
+					count = len(parks)
+				}
+				parks, err = api.FetchDrivingDistances(c.Request().Context(), httpClient, [2]float64{latitude, longitude}, parks, count)
 				if err != nil {
 					return c.String(http.StatusInternalServerError, err.Error())
 				}
@@ -360,6 +640,10 @@ func main() {
 					return c.String(http.StatusInternalServerError, err.Error())
 				}
 				for _, park := range parks {
+					// parks with an unknown drive are fetched again by the next search
+					if !park.HasDrive() {
+						continue
+					}
 					placePark := models.NewRecord(placeParks)
 					placePark.Set("place", placeRecord.Id)
 					placePark.Set("park", park.ParkRecordId)
@@ -371,11 +655,16 @@ func main() {
 						return err
 					}
 				}
+				if options.Mode == api.SortWeather {
+					api.SortByWeather(parks, options.Trip)
+				}
+				api.DeprioritizeUnhealthyAir(parks, options.Trip)
+				parks = parks[:min(8, len(parks))]
 				if c.Request().Header.Get("HX-Request") == "true" {
-					c.Response().Header().Set("HX-Push-Url", "/place/"+placeName+"/"+stateName)
-					return template.Html(c, components.Parks(parks, placeName, stateName))
+					c.Response().Header().Set("HX-Push-Url", placeURL(placeName, stateName, options))
+					return template.Html(c, components.Parks(parks, placeName, stateName, options))
 				} else {
-					return template.Html(c, components.Index(mapboxAccessToken, parks, placeName, stateName))
+					return template.Html(c, components.Index(mapboxAccessToken, parks, placeName, stateName, options))
 				}
 			}
 		})
@@ -387,8 +676,9 @@ func main() {
 			if err != nil {
 				return c.String(http.StatusBadRequest, "Invalid currentCount value")
 			}
+			options := api.ParseSortOptions(c.QueryParam("sort"), c.QueryParam("from"), c.QueryParam("to"), c.QueryParam("designation"))
 			// get all records from nationalParks collection
-			records, err := app.Dao().FindRecordsByExpr("parks", nil)
+			records, err := app.Dao().FindRecordsByExpr("parks", options.ParkFilter())
 			if err != nil {
 				return c.String(http.StatusInternalServerError, err.Error())
 			}
@@ -400,10 +690,15 @@ func main() {
 				park.Description = record.GetString("description")
 				park.States = record.GetString("states")
 				park.Images = record.Get("images").([]string)
+				park.ImageMeta = api.LoadImageMeta(record)
 				park.Longitude = record.GetString("longitude")
 				park.Latitude = record.GetString("latitude")
 				park.ParkRecordId = record.Id
 				park.ParkCode = record.GetString("parkCode")
+				park.Designation = record.GetString("designation")
+				park.Weather = api.LoadWeather(record)
+				park.UTCOffset = record.GetInt("weatherUtcOffset")
+				park.AirQuality = api.LoadAirQuality(record)
 				parks = append(parks, park)
 			}
 			// get all records from placeParks collection
@@ -420,6 +715,32 @@ func main() {
 			sort.Slice(placeParks, func(i, j int) bool {
 				return placeParks[i].GetFloat("haversineDistance") < placeParks[j].GetFloat("haversineDistance")
 			})
+			// count only the parks of the chosen designation
+			if options.Designation != "" {
+				placeParks = slices.DeleteFunc(placeParks, func(placePark *models.Record) bool {
+					return !slices.ContainsFunc(parks, func(park api.Park) bool {
+						return park.ParkRecordId == placePark.GetStringSlice("park")[0]
+					})
+				})
+			}
+			if options.Mode == api.SortWeather && len(placeParks) >= currentCount+4 {
+				// the next 4 parks with the best weather among those with a known drive
+				var placeParksByWeather []api.Park
+				for _, placePark := range placeParks {
+					for _, park := range parks {
+						if park.ParkRecordId == placePark.GetStringSlice("park")[0] {
+							park.DrivingDistanceMi = placePark.GetString("drivingDistanceMi")
+							park.DrivingDistanceKm = placePark.GetString("drivingDistanceKm")
+							park.DriveTime = placePark.GetString("driveTime")
+							placeParksByWeather = append(placeParksByWeather, park)
+						}
+					}
+				}
+				api.SortByWeather(placeParksByWeather, options.Trip)
+				api.DeprioritizeUnhealthyAir(placeParksByWeather, options.Trip)
+				newParks := placeParksByWeather[min(currentCount, len(placeParksByWeather)):min(currentCount+4, len(placeParksByWeather))]
+				return template.Html(c, components.MoreParks(newParks, placeName, stateName, options.Trip))
+			}
 			// get the next 4 closest parks
 			if len(placeParks) >= currentCount+4 {
 				placeParks = placeParks[currentCount : currentCount+4]
@@ -435,7 +756,8 @@ func main() {
 						}
 					}
 				}
-				return template.Html(c, components.MoreParks(newParks, placeName, stateName))
+				api.DeprioritizeUnhealthyAir(newParks, options.Trip)
+				return template.Html(c, components.MoreParks(newParks, placeName, stateName, options.Trip))
 			} else {
 				// remove current parks from the list, then get driving distances to next 4 closest parks
 				var newParks []api.Park
@@ -452,7 +774,7 @@ func main() {
 					}
 				}
 				// Fetch driving distances
-				newParks, err = api.FetchDrivingDistances([2]float64{placeRecord.GetFloat("latitude"), placeRecord.GetFloat("longitude")}, newParks, 4)
+				newParks, err = api.FetchDrivingDistances(c.Request().Context(), httpClient, [2]float64{placeRecord.GetFloat("latitude"), placeRecord.GetFloat("longitude")}, newParks, 4)
 				if err != nil {
 					return c.String(http.StatusInternalServerError, err.Error())
 				}
@@ -462,6 +784,9 @@ func main() {
 					return c.String(http.StatusInternalServerError, err.Error())
 				}
 				for _, park := range newParks {
+					if !park.HasDrive() {
+						continue
+					}
 					placePark := models.NewRecord(placeParks)
 					placePark.Set("place", placeRecord.Id)
 					placePark.Set("park", park.ParkRecordId)
@@ -473,50 +798,65 @@ func main() {
 						return err
 					}
 				}
-				return template.Html(c, components.MoreParks(newParks, placeName, stateName))
+				if options.Mode == api.SortWeather {
+					api.SortByWeather(newParks, options.Trip)
+				}
+				api.DeprioritizeUnhealthyAir(newParks, options.Trip)
+				return template.Html(c, components.MoreParks(newParks, placeName, stateName, options.Trip))
 			}
 		})
 
-		// route to fetch parks, commented because Pocketbase scheduler is set up to fetch parks every week
-		e.Router.GET("/api/update-park-data", api.FetchAndStoreNationalParksHTTP(app))
-		// route to fetch weather data
-		e.Router.GET("/api/update-weather-data", api.FetchAndStoreWeatherHTTP(app))
-		// route to fetch alerts
-		e.Router.GET("/api/update-alerts", api.FetchAlertsHTTP(app))
+		// routes starting a data refresh in the background, for admins or with an API token
+		requireAdmin := api.RequireAdminOrAPIToken(apiTokenSecret)
+		e.Router.POST("/api/update-park-data", jobs.EnqueueHTTP(api.JobUpdateParks), requireAdmin)
+		e.Router.POST("/api/update-weather-data", jobs.EnqueueHTTP(api.JobUpdateWeather), requireAdmin)
+		e.Router.POST("/api/update-alerts", jobs.EnqueueHTTP(api.JobUpdateAlerts), requireAdmin)
+		if airQualityProvider != nil {
+			e.Router.POST("/api/update-air-quality", jobs.EnqueueHTTP(api.JobUpdateAirQuality), requireAdmin)
+		}
+		// progress and cancellation of a job run queued above
+		e.Router.GET("/api/jobs/:id", api.JobStatusHTTP(app), requireAdmin)
+		e.Router.POST("/api/jobs/:id/cancel", jobs.CancelHTTP(), requireAdmin)
 
-		// Start a cron that fetches and stores National Parks data once a week
-		scheduler := cron.New()
-		scheduler.MustAdd("updateParks", "0 0 * * 0", func() {
-			log.Println("Fetching and storing National Parks data...")
-			err := api.FetchAndStoreNationalParks(app)
-			if err != nil {
-				log.Println("Error fetching National Parks data:", err)
-				return
-			}
-			log.Println("National Parks data fetched and stored!")
+		// admin page listing the recent job runs, the list itself requires admin auth
+		e.Router.GET("/admin/jobs", func(c echo.Context) error {
+			return template.Html(c, components.Jobs())
 		})
-		// update weather data every 4 hours, at 10 minutes past the hour
-		scheduler.MustAdd("updateWeather", "10 */4 * * *", func() {
-			log.Println("Fetching and storing weather data...")
-			err := api.FetchAndStoreWeather(app)
+		e.Router.GET("/admin/jobs/runs", func(c echo.Context) error {
+			runs, err := api.RecentJobRuns(app, 50)
 			if err != nil {
-				log.Println("Error fetching weather data:", err)
-				return
+				return c.String(http.StatusInternalServerError, err.Error())
 			}
-			log.Println("Weather data fetched and stored!")
-		})
-		// update alerts every 6 hours, at 15 minutes past the hour
-		scheduler.MustAdd("updateAlerts", "15 */6 * * *", func() {
-			log.Println("Fetching and storing alerts data...")
-			err := api.FetchAlerts(app)
-			if err != nil {
-				log.Println("Error fetching alerts data:", err)
-				return
+			return template.Html(c, components.JobRuns(runs))
+		}, apis.RequireAdminAuth())
+
+		// Start a cron that queues the National Parks data update once a week
+		scheduler := cron.New()
+		enqueue := func(job string) func() {
+			return func() {
+				if _, err := jobs.Enqueue(job, api.TriggerCron, nil); err != nil {
+					log.Printf("Error queueing %s: %v", job, err)
+				}
 			}
-			log.Println("Alerts data fetched and stored!")
-		})
+		}
+		scheduler.MustAdd(api.JobUpdateParks, "0 0 * * 0", enqueue(api.JobUpdateParks))
+		// update weather data every 4 hours, at 10 minutes past the hour
+		scheduler.MustAdd(api.JobUpdateWeather, "10 */4 * * *", enqueue(api.JobUpdateWeather))
+		// update alerts every 6 hours, at 15 minutes past the hour
+		scheduler.MustAdd(api.JobUpdateAlerts, "15 */6 * * *", enqueue(api.JobUpdateAlerts))
+		// update air quality every 2 hours, at 20 minutes past the hour
+		if airQualityProvider != nil {
+			scheduler.MustAdd(api.JobUpdateAirQuality, "20 */2 * * *", enqueue(api.JobUpdateAirQuality))
+		}
 		scheduler.Start()
 
+		// run the queued jobs until the server stops, unfinished runs are queued again
+		jobs.Start()
+		app.OnTerminate().Add(func(e *core.TerminateEvent) error {
+			jobs.Stop()
+			return nil
+		})
+
 		return nil
 	})
 
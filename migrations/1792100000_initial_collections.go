@@ -0,0 +1,151 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ids of the collections linked to by id, the templates build the file urls of the parks
+// and campgrounds photos with them
+const (
+	parksCollectionId       = "bov1ang23ob74q6"
+	campgroundsCollectionId = "cnpa06hb04mppdu"
+)
+
+func textField(name string) *schema.SchemaField {
+	return &schema.SchemaField{Name: name, Type: schema.FieldTypeText, Options: &schema.TextOptions{}}
+}
+
+func numberField(name string) *schema.SchemaField {
+	return &schema.SchemaField{Name: name, Type: schema.FieldTypeNumber, Options: &schema.NumberOptions{}}
+}
+
+func relationField(name string, collectionId string) *schema.SchemaField {
+	return &schema.SchemaField{
+		Name:    name,
+		Type:    schema.FieldTypeRelation,
+		Options: &schema.RelationOptions{CollectionId: collectionId, MaxSelect: types.Pointer(1)},
+	}
+}
+
+func imagesField(name string, maxSelect int) *schema.SchemaField {
+	return &schema.SchemaField{
+		Name: name,
+		Type: schema.FieldTypeFile,
+		Options: &schema.FileOptions{
+			MimeTypes: []string{"image/jpeg", "image/png", "image/webp"},
+			MaxSelect: maxSelect,
+			MaxSize:   5242880,
+		},
+	}
+}
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// the collections of the first release were created in the admin UI, databases
+		// that already have them are left as they are
+		parks := &models.Collection{
+			Name: "parks",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				textField("parkCode"),
+				textField("name"),
+				textField("description"),
+				textField("latitude"),
+				textField("longitude"),
+				textField("states"),
+				textField("weatherInfo"),
+				textField("directionsInfo"),
+				imagesField("images", 99),
+				numberField("campgrounds"),
+				&schema.SchemaField{
+					Name:    "weather",
+					Type:    schema.FieldTypeJson,
+					Options: &schema.JsonOptions{MaxSize: 2000000},
+				},
+			),
+		}
+		parks.Id = parksCollectionId
+		campgrounds := &models.Collection{
+			Name: "campgrounds",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				textField("campId"),
+				relationField("parkId", parksCollectionId),
+				textField("name"),
+				textField("description"),
+				textField("latitude"),
+				textField("longitude"),
+				textField("reservationInfo"),
+				textField("reservationUrl"),
+				textField("directionsOverview"),
+				textField("weatherOverview"),
+				numberField("reservable"),
+				numberField("firstComeFirstServe"),
+				imagesField("images", 99),
+				imagesField("mapImage", 1),
+			),
+		}
+		campgrounds.Id = campgroundsCollectionId
+		alerts := &models.Collection{
+			Name: "alerts",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				relationField("park", parksCollectionId),
+				textField("title"),
+				textField("description"),
+				textField("category"),
+				textField("url"),
+			),
+		}
+		// places searched on the index page and their driving distances to the parks
+		places := &models.Collection{
+			Name: "places",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				textField("placeName"),
+				numberField("longitude"),
+				numberField("latitude"),
+			),
+		}
+		for _, collection := range []*models.Collection{parks, campgrounds, alerts, places} {
+			if err := saveMissingCollection(dao, collection); err != nil {
+				return err
+			}
+		}
+		places, err := dao.FindCollectionByNameOrId("places")
+		if err != nil {
+			return err
+		}
+		placeParks := &models.Collection{
+			Name: "placeParks",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				relationField("place", places.Id),
+				relationField("park", parksCollectionId),
+				textField("drivingDistanceMi"),
+				textField("drivingDistanceKm"),
+				textField("driveTime"),
+				numberField("haversineDistance"),
+			),
+		}
+		return saveMissingCollection(dao, placeParks)
+	}, func(db dbx.Builder) error {
+		// the collections may predate this migration and hold all the data, they are kept
+		return nil
+	})
+}
+
+// saveMissingCollection creates a collection, unless a collection with its name exists
+func saveMissingCollection(dao *daos.Dao, collection *models.Collection) error {
+	if _, err := dao.FindCollectionByNameOrId(collection.Name); err == nil {
+		return nil
+	}
+	return dao.SaveCollection(collection)
+}
@@ -0,0 +1,69 @@
+// Package migrations contains the collection changes of parkpilot, applied on serve
+// or with the migrate command.
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// store the designation of each park
+		parks, err := dao.FindCollectionByNameOrId("parks")
+		if err != nil {
+			return err
+		}
+		parks.Schema.AddField(&schema.SchemaField{
+			Name:    "designation",
+			Type:    schema.FieldTypeText,
+			Options: &schema.TextOptions{},
+		})
+		if err := dao.SaveCollection(parks); err != nil {
+			return err
+		}
+
+		// admin editable settings, only the first record is used. The record is seeded
+		// without designations so that PARK_DESIGNATIONS applies until an admin sets them.
+		settings := &models.Collection{
+			Name: "settings",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:    "parkDesignations",
+					Type:    schema.FieldTypeJson,
+					Options: &schema.JsonOptions{MaxSize: 2000000},
+				},
+			),
+		}
+		if err := dao.SaveCollection(settings); err != nil {
+			return err
+		}
+		record := models.NewRecord(settings)
+		record.Set("parkDesignations", []string{})
+		return dao.SaveRecord(record)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		settings, err := dao.FindCollectionByNameOrId("settings")
+		if err != nil {
+			return err
+		}
+		if err := dao.DeleteCollection(settings); err != nil {
+			return err
+		}
+		parks, err := dao.FindCollectionByNameOrId("parks")
+		if err != nil {
+			return err
+		}
+		if field := parks.Schema.GetFieldByName("designation"); field != nil {
+			parks.Schema.RemoveField(field.Id)
+		}
+		return dao.SaveCollection(parks)
+	})
+}
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// smaller copies of the photos and the metadata linking them to each photo
+		for _, name := range []string{"parks", "campgrounds"} {
+			collection, err := dao.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			collection.Schema.AddField(&schema.SchemaField{
+				Name: "imageVariants",
+				Type: schema.FieldTypeFile,
+				Options: &schema.FileOptions{
+					MimeTypes: []string{"image/jpeg", "image/png", "image/webp"},
+					MaxSelect: 999,
+					MaxSize:   5242880,
+				},
+			})
+			collection.Schema.AddField(&schema.SchemaField{
+				Name:    "imageMeta",
+				Type:    schema.FieldTypeJson,
+				Options: &schema.JsonOptions{MaxSize: 2000000},
+			})
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		for _, name := range []string{"parks", "campgrounds"} {
+			collection, err := dao.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			for _, field := range []string{"imageVariants", "imageMeta"} {
+				if f := collection.Schema.GetFieldByName(field); f != nil {
+					collection.Schema.RemoveField(f.Id)
+				}
+			}
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// one record per run of an ingestion job, only admins can read them
+		jobRuns := &models.Collection{
+			Name: "jobRuns",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "job",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name: "trigger",
+					Type: schema.FieldTypeSelect,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    []string{"cron", "cli", "http"},
+					},
+				},
+				&schema.SchemaField{
+					Name: "status",
+					Type: schema.FieldTypeSelect,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    []string{"running", "succeeded", "partial", "failed"},
+					},
+				},
+				&schema.SchemaField{
+					Name:    "startedAt",
+					Type:    schema.FieldTypeDate,
+					Options: &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "finishedAt",
+					Type:    schema.FieldTypeDate,
+					Options: &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "recordsCreated",
+					Type:    schema.FieldTypeNumber,
+					Options: &schema.NumberOptions{NoDecimal: true},
+				},
+				&schema.SchemaField{
+					Name:    "recordsUpdated",
+					Type:    schema.FieldTypeNumber,
+					Options: &schema.NumberOptions{NoDecimal: true},
+				},
+				&schema.SchemaField{
+					Name:    "recordsFailed",
+					Type:    schema.FieldTypeNumber,
+					Options: &schema.NumberOptions{NoDecimal: true},
+				},
+				&schema.SchemaField{
+					Name:    "errors",
+					Type:    schema.FieldTypeJson,
+					Options: &schema.JsonOptions{MaxSize: 2000000},
+				},
+				&schema.SchemaField{
+					Name:    "error",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+			),
+			Indexes: types.JsonArray[string]{
+				"CREATE INDEX `idx_jobRuns_startedAt` ON `jobRuns` (`startedAt`)",
+			},
+		}
+		return dao.SaveCollection(jobRuns)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		jobRuns, err := dao.FindCollectionByNameOrId("jobRuns")
+		if err != nil {
+			return err
+		}
+		return dao.DeleteCollection(jobRuns)
+	})
+}
@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// the job runs double as the job queue
+		jobRuns, err := dao.FindCollectionByNameOrId("jobRuns")
+		if err != nil {
+			return err
+		}
+		if status := jobRuns.Schema.GetFieldByName("status"); status != nil {
+			status.Options = &schema.SelectOptions{
+				MaxSelect: 1,
+				Values:    []string{"queued", "running", "succeeded", "partial", "failed", "cancelled"},
+			}
+		}
+		jobRuns.Schema.AddField(&schema.SchemaField{
+			Name:    "params",
+			Type:    schema.FieldTypeJson,
+			Options: &schema.JsonOptions{MaxSize: 2000000},
+		})
+		jobRuns.Schema.AddField(&schema.SchemaField{
+			Name:    "attempts",
+			Type:    schema.FieldTypeNumber,
+			Options: &schema.NumberOptions{NoDecimal: true},
+		})
+		// queued runs wait until runAfter, retries are delayed
+		jobRuns.Schema.AddField(&schema.SchemaField{
+			Name:    "runAfter",
+			Type:    schema.FieldTypeDate,
+			Options: &schema.DateOptions{},
+		})
+		jobRuns.Schema.AddField(&schema.SchemaField{
+			Name:    "heartbeatAt",
+			Type:    schema.FieldTypeDate,
+			Options: &schema.DateOptions{},
+		})
+		jobRuns.Schema.AddField(&schema.SchemaField{
+			Name:    "cancelRequested",
+			Type:    schema.FieldTypeBool,
+			Options: &schema.BoolOptions{},
+		})
+		jobRuns.Indexes = append(jobRuns.Indexes, "CREATE INDEX `idx_jobRuns_job_status` ON `jobRuns` (`job`, `status`)")
+		return dao.SaveCollection(jobRuns)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		jobRuns, err := dao.FindCollectionByNameOrId("jobRuns")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"params", "attempts", "runAfter", "heartbeatAt", "cancelRequested"} {
+			if field := jobRuns.Schema.GetFieldByName(name); field != nil {
+				jobRuns.Schema.RemoveField(field.Id)
+			}
+		}
+		if status := jobRuns.Schema.GetFieldByName("status"); status != nil {
+			status.Options = &schema.SelectOptions{
+				MaxSelect: 1,
+				Values:    []string{"running", "succeeded", "partial", "failed"},
+			}
+		}
+		jobRuns.Indexes = slices.DeleteFunc(jobRuns.Indexes, func(index string) bool {
+			return strings.Contains(index, "idx_jobRuns_job_status")
+		})
+		return dao.SaveCollection(jobRuns)
+	})
+}
@@ -0,0 +1,147 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// hash of the provider data of the last stored version of a record
+		for _, name := range []string{"parks", "campgrounds"} {
+			collection, err := dao.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			collection.Schema.AddField(&schema.SchemaField{
+				Name:    "contentHash",
+				Type:    schema.FieldTypeText,
+				Options: &schema.TextOptions{},
+			})
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+
+		jobRuns, err := dao.FindCollectionByNameOrId("jobRuns")
+		if err != nil {
+			return err
+		}
+		jobRuns.Schema.AddField(&schema.SchemaField{
+			Name:    "recordsUnchanged",
+			Type:    schema.FieldTypeNumber,
+			Options: &schema.NumberOptions{NoDecimal: true},
+		})
+		jobRuns.Schema.AddField(&schema.SchemaField{
+			Name:    "changes",
+			Type:    schema.FieldTypeJson,
+			Options: &schema.JsonOptions{MaxSize: 2000000},
+		})
+		if err := dao.SaveCollection(jobRuns); err != nil {
+			return err
+		}
+
+		// audit log of the fields changed by the park ingestion, only admins can read it
+		parkChanges := &models.Collection{
+			Name: "parkChanges",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "kind",
+					Type:     schema.FieldTypeSelect,
+					Required: true,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    []string{"park", "campground"},
+					},
+				},
+				&schema.SchemaField{
+					Name:    "recordId",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name: "park",
+					Type: schema.FieldTypeRelation,
+					Options: &schema.RelationOptions{
+						CollectionId:  "bov1ang23ob74q6",
+						CascadeDelete: true,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "field",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "oldValue",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "newValue",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "changedAt",
+					Type:    schema.FieldTypeDate,
+					Options: &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "jobRun",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+			),
+			Indexes: types.JsonArray[string]{
+				"CREATE INDEX `idx_parkChanges_recordId` ON `parkChanges` (`recordId`)",
+				"CREATE INDEX `idx_parkChanges_changedAt` ON `parkChanges` (`changedAt`)",
+			},
+		}
+		return dao.SaveCollection(parkChanges)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		parkChanges, err := dao.FindCollectionByNameOrId("parkChanges")
+		if err != nil {
+			return err
+		}
+		if err := dao.DeleteCollection(parkChanges); err != nil {
+			return err
+		}
+		jobRuns, err := dao.FindCollectionByNameOrId("jobRuns")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"recordsUnchanged", "changes"} {
+			if field := jobRuns.Schema.GetFieldByName(name); field != nil {
+				jobRuns.Schema.RemoveField(field.Id)
+			}
+		}
+		if err := dao.SaveCollection(jobRuns); err != nil {
+			return err
+		}
+		for _, name := range []string{"parks", "campgrounds"} {
+			collection, err := dao.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if field := collection.Schema.GetFieldByName("contentHash"); field != nil {
+				collection.Schema.RemoveField(field.Id)
+			}
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// parks and campgrounds no longer listed by the provider are retired, not deleted
+		for _, name := range []string{"parks", "campgrounds"} {
+			collection, err := dao.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			collection.Schema.AddField(&schema.SchemaField{
+				Name:    "retiredAt",
+				Type:    schema.FieldTypeDate,
+				Options: &schema.DateOptions{},
+			})
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		for _, name := range []string{"parks", "campgrounds"} {
+			collection, err := dao.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if field := collection.Schema.GetFieldByName("retiredAt"); field != nil {
+				collection.Schema.RemoveField(field.Id)
+			}
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// hourly forecasts of the parks, one record per park and issue time
+		forecasts := &models.Collection{
+			Name: "forecasts",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "park",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						CollectionId:  "bov1ang23ob74q6",
+						CascadeDelete: true,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "issuedAt",
+					Type:     schema.FieldTypeDate,
+					Required: true,
+					Options:  &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "provider",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "utcOffset",
+					Type:    schema.FieldTypeNumber,
+					Options: &schema.NumberOptions{NoDecimal: true},
+				},
+				&schema.SchemaField{
+					Name:    "hours",
+					Type:    schema.FieldTypeJson,
+					Options: &schema.JsonOptions{MaxSize: 2000000},
+				},
+			),
+			Indexes: types.JsonArray[string]{
+				"CREATE UNIQUE INDEX `idx_forecasts_park_issuedAt` ON `forecasts` (`park`, `issuedAt`)",
+			},
+		}
+		return dao.SaveCollection(forecasts)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		forecasts, err := dao.FindCollectionByNameOrId("forecasts")
+		if err != nil {
+			return err
+		}
+		return dao.DeleteCollection(forecasts)
+	})
+}
@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// weather warnings are stored with the park alerts
+		alerts, err := dao.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Schema.AddField(&schema.SchemaField{
+			Name:    "source",
+			Type:    schema.FieldTypeText,
+			Options: &schema.TextOptions{},
+		})
+		alerts.Schema.AddField(&schema.SchemaField{
+			Name: "severity",
+			Type: schema.FieldTypeSelect,
+			Options: &schema.SelectOptions{
+				MaxSelect: 1,
+				Values:    []string{"extreme", "severe", "moderate", "minor", "unknown"},
+			},
+		})
+		alerts.Schema.AddField(&schema.SchemaField{
+			Name:    "effective",
+			Type:    schema.FieldTypeDate,
+			Options: &schema.DateOptions{},
+		})
+		alerts.Schema.AddField(&schema.SchemaField{
+			Name:    "expires",
+			Type:    schema.FieldTypeDate,
+			Options: &schema.DateOptions{},
+		})
+		if err := dao.SaveCollection(alerts); err != nil {
+			return err
+		}
+		// the existing alerts all come from the NPS
+		_, err = db.NewQuery("UPDATE alerts SET source = 'nps'").Execute()
+		return err
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		alerts, err := dao.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"source", "severity", "effective", "expires"} {
+			if field := alerts.Schema.GetFieldByName(name); field != nil {
+				alerts.Schema.RemoveField(field.Id)
+			}
+		}
+		return dao.SaveCollection(alerts)
+	})
+}
@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// monthly climate normals of the parks, one record per park and month, in metric units
+		number := func(name string) *schema.SchemaField {
+			return &schema.SchemaField{
+				Name:    name,
+				Type:    schema.FieldTypeNumber,
+				Options: &schema.NumberOptions{},
+			}
+		}
+		parkClimate := &models.Collection{
+			Name: "parkClimate",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "park",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						CollectionId:  "bov1ang23ob74q6",
+						CascadeDelete: true,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "month",
+					Type:     schema.FieldTypeNumber,
+					Required: true,
+					Options: &schema.NumberOptions{
+						Min:       types.Pointer(1.0),
+						Max:       types.Pointer(12.0),
+						NoDecimal: true,
+					},
+				},
+				number("highC"),
+				number("lowC"),
+				number("precipMm"),
+				number("precipDays"),
+				number("snowCm"),
+				&schema.SchemaField{
+					Name:    "source",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+			),
+			Indexes: types.JsonArray[string]{
+				"CREATE UNIQUE INDEX `idx_parkClimate_park_month` ON `parkClimate` (`park`, `month`)",
+			},
+		}
+		return dao.SaveCollection(parkClimate)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		parkClimate, err := dao.FindCollectionByNameOrId("parkClimate")
+		if err != nil {
+			return err
+		}
+		return dao.DeleteCollection(parkClimate)
+	})
+}
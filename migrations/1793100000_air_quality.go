@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// current and forecast AQI of the parks, replaced by every air quality run
+		parks, err := dao.FindCollectionByNameOrId("parks")
+		if err != nil {
+			return err
+		}
+		parks.Schema.AddField(&schema.SchemaField{
+			Name:    "airQuality",
+			Type:    schema.FieldTypeJson,
+			Options: &schema.JsonOptions{MaxSize: 20000},
+		})
+		return dao.SaveCollection(parks)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		parks, err := dao.FindCollectionByNameOrId("parks")
+		if err != nil {
+			return err
+		}
+		if field := parks.Schema.GetFieldByName("airQuality"); field != nil {
+			parks.Schema.RemoveField(field.Id)
+		}
+		return dao.SaveCollection(parks)
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// when the stored forecast of a park was issued, and why the last update failed
+		parks, err := dao.FindCollectionByNameOrId("parks")
+		if err != nil {
+			return err
+		}
+		parks.Schema.AddField(&schema.SchemaField{
+			Name:    "weatherIssuedAt",
+			Type:    schema.FieldTypeDate,
+			Options: &schema.DateOptions{},
+		})
+		parks.Schema.AddField(&schema.SchemaField{
+			Name:    "weatherUtcOffset",
+			Type:    schema.FieldTypeNumber,
+			Options: &schema.NumberOptions{NoDecimal: true},
+		})
+		parks.Schema.AddField(&schema.SchemaField{
+			Name:    "weatherError",
+			Type:    schema.FieldTypeText,
+			Options: &schema.TextOptions{},
+		})
+		parks.Schema.AddField(&schema.SchemaField{
+			Name:    "weatherErrorAt",
+			Type:    schema.FieldTypeDate,
+			Options: &schema.DateOptions{},
+		})
+		return dao.SaveCollection(parks)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		parks, err := dao.FindCollectionByNameOrId("parks")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"weatherIssuedAt", "weatherUtcOffset", "weatherError", "weatherErrorAt"} {
+			if field := parks.Schema.GetFieldByName(name); field != nil {
+				parks.Schema.RemoveField(field.Id)
+			}
+		}
+		return dao.SaveCollection(parks)
+	})
+}
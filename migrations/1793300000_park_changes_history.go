@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// setParkCascade sets whether the changes of a park are deleted with it
+func setParkCascade(parkChanges *schema.Schema, cascade bool) {
+	if field := parkChanges.GetFieldByName("park"); field != nil {
+		if options, ok := field.Options.(*schema.RelationOptions); ok {
+			options.CascadeDelete = cascade
+		}
+	}
+}
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// the change history outlives pruned parks, the park relation is cleared on delete
+		// and the park code identifies the park instead
+		parkChanges, err := dao.FindCollectionByNameOrId("parkChanges")
+		if err != nil {
+			return err
+		}
+		setParkCascade(&parkChanges.Schema, false)
+		parkChanges.Schema.AddField(&schema.SchemaField{
+			Name:    "parkCode",
+			Type:    schema.FieldTypeText,
+			Options: &schema.TextOptions{},
+		})
+		parkChanges.Indexes = append(parkChanges.Indexes, "CREATE INDEX `idx_parkChanges_parkCode` ON `parkChanges` (`parkCode`)")
+		if err := dao.SaveCollection(parkChanges); err != nil {
+			return err
+		}
+		_, err = db.NewQuery("UPDATE parkChanges SET parkCode = COALESCE((SELECT parkCode FROM parks WHERE parks.id = parkChanges.park), '')").Execute()
+		return err
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		parkChanges, err := dao.FindCollectionByNameOrId("parkChanges")
+		if err != nil {
+			return err
+		}
+		setParkCascade(&parkChanges.Schema, true)
+		if field := parkChanges.Schema.GetFieldByName("parkCode"); field != nil {
+			parkChanges.Schema.RemoveField(field.Id)
+		}
+		indexes := types.JsonArray[string]{}
+		for _, index := range parkChanges.Indexes {
+			if index != "CREATE INDEX `idx_parkChanges_parkCode` ON `parkChanges` (`parkCode`)" {
+				indexes = append(indexes, index)
+			}
+		}
+		parkChanges.Indexes = indexes
+		return dao.SaveCollection(parkChanges)
+	})
+}